@@ -3,13 +3,16 @@ package main
 import (
 	"context"
 	"log"
-	"time"
 	"my-bot-go/internal/config"
 	"my-bot-go/internal/crawler"
 	"my-bot-go/internal/database"
+	"my-bot-go/internal/metrics"
+	"my-bot-go/internal/scheduler"
 	"my-bot-go/internal/telegram"
 	"os"
 	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
@@ -20,52 +23,62 @@ func main() {
 		log.Fatal("❌ BOT_TOKEN is missing")
 	}
 
-	db := database.NewD1Client(cfg)
+	db, err := database.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
 	db.SyncHistory() 
 
 	
-	botHandler, err := telegram.NewBot(cfg, db)
+	// 爬虫的运行情况，/status 查看
+	reg := metrics.NewRegistry()
+
+	botHandler, err := telegram.NewBot(cfg, db, reg)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	
-	go crawler.StartYande(ctx, cfg, db, botHandler)
-	
-    go func() {
-        time.Sleep(5 * time.Minute)
-        crawler.StartPixiv(ctx, cfg, db, botHandler)
-    }()
+	// 写库失败的行在后台按退避重试
+	db.RunQueue(ctx)
 
-	//其他爬虫脚本，还为完善。
-	///go crawler.StartDanbooru(ctx, cfg, db, botHandler)///
-	///go crawler.StartKemono(ctx, cfg, db, botHandler)///
-
-    go func() {
-        time.Sleep(10 * time.Minute)
-        crawler.StartCosineTag(ctx, cfg, db, botHandler)
-    }()
-
-    go func() {
-        time.Sleep(15 * time.Minute)
-        crawler.StartManyACGAll(ctx, cfg, db, botHandler)
-    }()
-
-	//没必要开了
-	///go crawler.StartManyACGSese(ctx, cfg, db, botHandler)///
+	// 所有已注册的爬虫交给调度器，间隔/cron/抖动见 CRAWL_* 配置
+	// 未完善/没必要开的 (Danbooru, Kemono, Sese) 在注册时默认关闭
+	sched := scheduler.New()
+	for _, job := range crawler.Jobs(cfg, db, botHandler, reg) {
+		if err := sched.Add(job); err != nil {
+			log.Printf("⚠️ Schedule failed: %v", err)
+		}
+	}
+	sched.Start(ctx)
 
-    go func() {
-        time.Sleep(20 * time.Minute)
-        crawler.StartManyACG(ctx, cfg, db, botHandler)
-    }()
+	// /crawl 手动跑一轮，和定时任务共用同一套图源
+	botHandler.SetCrawler(crawler.NewManual(cfg, db, botHandler))
 
 	log.Println("👂 Bot is listening...")
 	botHandler.Start(ctx)
 
-	log.Println("🛑 Shutting down... Saving history...")
-	db.PushHistory()
+	log.Println("🛑 Shutting down... Waiting for in-flight uploads...")
+	deadline := time.Now().Add(cfg.ShutdownTimeout)
+	stopped := make(chan struct{})
+	go func() {
+		sched.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(cfg.ShutdownTimeout):
+		log.Println("⚠️ Crawlers did not stop before the shutdown deadline")
+	}
+	if !botHandler.Wait(time.Until(deadline)) {
+		log.Println("⚠️ Some uploads were still running at the shutdown deadline")
+	}
+
+	log.Println("💾 Saving history...")
+	db.Flush()
+	db.PushHistoryNow()
 	log.Println("👋 Bye!")
 }
@@ -0,0 +1,64 @@
+// Package canonical 把各个镜像站 (ManyACG、Cosine 等) 抓到的作品映射回原站的 ID
+// 映射结果与对应原站爬虫生成的 post ID 完全一致，这样不同来源的同一张图可以互相去重
+package canonical
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	pixivArtworkRe = regexp.MustCompile(`^/(?:[a-z]{2}/)?(?:artworks|i)/(\d+)`)
+	yandePostRe    = regexp.MustCompile(`^/post/show/(\d+)`)
+	danbooruPostRe = regexp.MustCompile(`^/posts/(\d+)`)
+)
+
+// FromURL 根据原作品链接和页码返回原站的 post ID，认不出的链接返回空字符串
+//
+//	https://www.pixiv.net/artworks/123  (page 2) -> pixiv_123_p2
+//	https://yande.re/post/show/456               -> yande_456
+//	https://danbooru.donmai.us/posts/789         -> danbooru_789
+func FromURL(sourceURL string, page int) string {
+	u, err := url.Parse(strings.TrimSpace(sourceURL))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+
+	switch host {
+	case "pixiv.net":
+		if m := pixivArtworkRe.FindStringSubmatch(u.Path); m != nil {
+			return Pixiv(m[1], page)
+		}
+		// 旧版链接：member_illust.php?illust_id=123
+		if id := u.Query().Get("illust_id"); id != "" && isDigits(id) {
+			return Pixiv(id, page)
+		}
+	case "yande.re":
+		// yande / danbooru 一个 post 只有一张图
+		if m := yandePostRe.FindStringSubmatch(u.Path); m != nil && page == 0 {
+			return "yande_" + m[1]
+		}
+	case "danbooru.donmai.us":
+		if m := danbooruPostRe.FindStringSubmatch(u.Path); m != nil && page == 0 {
+			return "danbooru_" + m[1]
+		}
+	}
+	return ""
+}
+
+// Pixiv 返回 Pixiv 作品第 page 页的 post ID
+func Pixiv(illustID string, page int) string {
+	return fmt.Sprintf("pixiv_%s_p%d", illustID, page)
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,33 @@
+package canonical
+
+import "testing"
+
+func TestFromURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		page int
+		want string
+	}{
+		{"https://www.pixiv.net/artworks/123", 0, "pixiv_123_p0"},
+		{"https://www.pixiv.net/artworks/123", 2, "pixiv_123_p2"},
+		{"https://pixiv.net/en/artworks/123", 1, "pixiv_123_p1"},
+		{"https://www.pixiv.net/i/123", 0, "pixiv_123_p0"},
+		{"https://www.pixiv.net/member_illust.php?mode=medium&illust_id=456", 3, "pixiv_456_p3"},
+		{"https://www.pixiv.net/member_illust.php?illust_id=abc", 0, ""},
+		{"  https://WWW.PIXIV.NET/artworks/123  ", 0, "pixiv_123_p0"},
+		{"https://yande.re/post/show/456", 0, "yande_456"},
+		{"https://yande.re/post/show/456", 1, ""},
+		{"https://danbooru.donmai.us/posts/789", 0, "danbooru_789"},
+		{"https://danbooru.donmai.us/posts/789", 1, ""},
+		{"https://x.com/i/status/111", 0, ""},
+		{"https://www.pixiv.net/users/123", 0, ""},
+		{"pixiv.net/artworks/123", 0, ""},
+		{"", 0, ""},
+		{"://bad", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := FromURL(tt.url, tt.page); got != tt.want {
+			t.Errorf("FromURL(%q, %d) = %q, want %q", tt.url, tt.page, got, tt.want)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package config
 
 import (
+	"image/color"
 	"log"
 	"os"
 	"strconv"
 	"strings"
+	"time"
+
+	"my-bot-go/internal/imageprep"
 
 	"github.com/joho/godotenv"
 )
@@ -14,13 +18,34 @@ type KemonoCreator struct {
 	UserIDs []string 
 }
 
+// Schedule 是单个爬虫的调度覆盖配置，零值表示沿用注册时的默认值
+type Schedule struct {
+	Interval time.Duration
+	Cron     string
+	Jitter   time.Duration
+	Delay    time.Duration
+	Enabled  *bool
+}
+
 type Config struct {
 	BotToken       string
+	TGAPIURL       string // Bot API 服务器地址，为空时用官方的 api.telegram.org
 	ChannelID      int64
 	CF_AccountID   string
 	CF_APIToken    string
 	D1_DatabaseID  string
+	StoreBackend   string // d1 (默认) 或 sqlite
+	SQLitePath     string
+	BatchSize      int           // 批量写库的条数阈值
+	BatchWait      time.Duration // 批量写库的最长等待时间
+	WriteQueuePath string        // 写库失败的行暂存在这里，稍后重试
+
+	// 感知哈希去重：汉明距离不超过 PHashDistance 视为同一张图 (<=0 关闭)
+	// PHashAction 为 skip (直接跳过) 或 link (不重复上传，复用已有的 file_id 存一条新记录)
+	PHashDistance int
+	PHashAction   string
 	WorkerURL      string
+	HistoryCachePath string // 本地历史缓存，启动时只拉增量
 	PixivPHPSESSID string
 	PixivLimit     int
 	PixivCrawlRange   int 
@@ -39,6 +64,47 @@ type Config struct {
 
 	CosineTags        []string 
 	CosineLimitPerTag int      
+
+	// 调度配置：CRAWL_JITTER 为全局随机抖动，Schedules 按爬虫名覆盖
+	CrawlJitter time.Duration
+	Schedules   map[string]Schedule
+
+	// 关机时等待进行中上传的最长时间
+	ShutdownTimeout time.Duration
+
+	// 每个 chat 每分钟最多发送的消息数，Telegram 对频道的限制大约是 20 条/分钟
+	TGRatePerMinute int
+
+	// 预览图去透明、补边时用的背景色
+	PreviewBackground color.Color
+
+	// 多页作品按相册 (sendMediaGroup) 发送，每组最多 10 张
+	AlbumMode bool
+
+	// 上传后端：telegram / s3 / local，按顺序上传，第一个成功的作为图库默认的引用
+	UploadBackends []string
+	S3Endpoint     string // 如 https://<account>.r2.cloudflarestorage.com 或 http://127.0.0.1:9000
+	S3Region       string
+	S3Bucket       string
+	S3AccessKey    string
+	S3SecretKey    string
+	S3PublicURL    string // 公开访问的前缀，留空则不记录 URL
+	LocalDir       string
+	LocalPublicURL string
+
+	// 原图超过 Telegram 50MB 限制时按顺序尝试的策略：reencode / storage / link
+	OriginalOversize []string
+	// storage 策略在 UPLOAD_BACKENDS 里没有别的后端时，单独存超限原图用的后端：local / s3
+	OversizeBackend string
+
+	// 权限：管理员可以用所有指令，编辑只能发图 (链接、手动转发、/forward_*)
+	AdminIDs     []int64
+	EditorIDs    []int64
+	AuditLogPath string // 被拒绝的操作追加写到这里，JSON Lines
+
+	// /forward_start 会话：保存在文件里，重启后继续；超过 TTL 没有新消息自动结束 (0 不超时)
+	ForwardSessionsPath string
+	ForwardSessionTTL   time.Duration
 }
 
 func Load() *Config {
@@ -85,11 +151,15 @@ func Load() *Config {
 
 	cfg := &Config{
 		BotToken:       getEnv("BOT_TOKEN", ""),
+		TGAPIURL:       getEnv("TG_API_URL", ""),
 		ChannelID:      channelID,
 		CF_AccountID:   getEnv("CLOUDFLARE_ACCOUNT_ID", ""),
 		CF_APIToken:    getEnv("CLOUDFLARE_API_TOKEN", ""),
 		D1_DatabaseID:  getEnv("D1_DATABASE_ID", ""),
+		StoreBackend:   strings.ToLower(getEnv("STORE_BACKEND", "d1")),
+		SQLitePath:     getEnv("SQLITE_PATH", "data/mtcacg.db"),
 		WorkerURL:      getEnv("WORKER_URL", ""),
+		HistoryCachePath: getEnv("HISTORY_CACHE_PATH", "data/history.json"),
 		PixivPHPSESSID: getEnv("PIXIV_PHPSESSID", ""),
 		FanboxCookie:  getEnv("FANBOX_COOKIE", ""), 
 		PixivLimit:     pixivLimit,
@@ -147,9 +217,159 @@ func Load() *Config {
 	cfg.DanbooruUsername = getEnv("DANBOORU_USERNAME", "")
 	cfg.DanbooruAPIKey = getEnv("DANBOORU_APIKEY", "")
 
+	// 解析爬虫调度配置
+	// 例：
+	// CRAWL_JITTER=2m
+	// CRAWL_YANDE_INTERVAL=61m
+	// CRAWL_PIXIV_CRON=0 */2 * * *
+	// CRAWL_MANYACG_ALL_DELAY=15m
+	// CRAWL_KEMONO_ENABLED=true
+	cfg.CrawlJitter = parseDuration("CRAWL_JITTER", getEnv("CRAWL_JITTER", "2m"))
+	cfg.Schedules = loadSchedules()
+	cfg.ShutdownTimeout = parseDuration("SHUTDOWN_TIMEOUT", getEnv("SHUTDOWN_TIMEOUT", "60s"))
+
+	// 批量写库：攒够 DB_BATCH_SIZE 条或等待超过 DB_BATCH_WAIT 就写一次
+	cfg.BatchSize, _ = strconv.Atoi(getEnv("DB_BATCH_SIZE", "20"))
+	cfg.BatchWait = parseDuration("DB_BATCH_WAIT", getEnv("DB_BATCH_WAIT", "30s"))
+	cfg.WriteQueuePath = getEnv("WRITE_QUEUE_PATH", "data/pending.jsonl")
+
+	// 感知哈希去重
+	// 默认关闭：差分、多页作品很容易被当成重复，开启前先用 PHASH_ACTION=link 观察
+	cfg.PHashDistance, err = strconv.Atoi(getEnv("PHASH_DISTANCE", "0"))
+	if err != nil {
+		log.Printf("⚠️ Warning: Invalid PHASH_DISTANCE: %v", err)
+		cfg.PHashDistance = 0
+	}
+	cfg.PHashAction = strings.ToLower(getEnv("PHASH_ACTION", "skip"))
+
+	cfg.TGRatePerMinute, _ = strconv.Atoi(getEnv("TG_RATE_PER_MINUTE", "20"))
+
+	cfg.PreviewBackground, err = imageprep.ParseColor(getEnv("PREVIEW_BACKGROUND", "#ffffff"))
+	if err != nil {
+		log.Printf("⚠️ Warning: Invalid PREVIEW_BACKGROUND: %v", err)
+		cfg.PreviewBackground = color.White
+	}
+
+	cfg.AlbumMode, err = strconv.ParseBool(getEnv("ALBUM_MODE", "true"))
+	if err != nil {
+		log.Printf("⚠️ Warning: Invalid ALBUM_MODE: %v", err)
+		cfg.AlbumMode = true
+	}
+
+	// 上传后端
+	// 例：
+	// UPLOAD_BACKENDS=telegram,s3
+	// S3_ENDPOINT=http://127.0.0.1:9000
+	// S3_BUCKET=mtcacg
+	for _, b := range strings.Split(getEnv("UPLOAD_BACKENDS", "telegram"), ",") {
+		if b = strings.ToLower(strings.TrimSpace(b)); b != "" {
+			cfg.UploadBackends = append(cfg.UploadBackends, b)
+		}
+	}
+	cfg.S3Endpoint = strings.TrimRight(getEnv("S3_ENDPOINT", ""), "/")
+	cfg.S3Region = getEnv("S3_REGION", "auto")
+	cfg.S3Bucket = getEnv("S3_BUCKET", "")
+	cfg.S3AccessKey = getEnv("S3_ACCESS_KEY", "")
+	cfg.S3SecretKey = getEnv("S3_SECRET_KEY", "")
+	cfg.S3PublicURL = strings.TrimRight(getEnv("S3_PUBLIC_URL", ""), "/")
+	cfg.LocalDir = getEnv("LOCAL_STORAGE_DIR", "data/images")
+	cfg.LocalPublicURL = strings.TrimRight(getEnv("LOCAL_PUBLIC_URL", ""), "/")
+
+	// 超限原图
+	// 例：ORIGINAL_OVERSIZE=reencode,link 只做无损重编码，不行就记原作品链接
+	for _, p := range strings.Split(getEnv("ORIGINAL_OVERSIZE", "reencode,storage,link"), ",") {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			cfg.OriginalOversize = append(cfg.OriginalOversize, p)
+		}
+	}
+	cfg.OversizeBackend = strings.ToLower(getEnv("OVERSIZE_BACKEND", "local"))
+
+	// 权限
+	// 例：ADMIN_IDS=123456789,987654321，没有默认值，不配置时所有管理指令都会被拒绝
+	cfg.AdminIDs = parseIDs("ADMIN_IDS", getEnv("ADMIN_IDS", ""))
+	if len(cfg.AdminIDs) == 0 {
+		log.Println("🚨 ADMIN_IDS is empty: nobody can use admin commands (/save, /delete, /crawl ...). Set ADMIN_IDS to your Telegram user ID!")
+	}
+	cfg.EditorIDs = parseIDs("EDITOR_IDS", getEnv("EDITOR_IDS", ""))
+	cfg.AuditLogPath = getEnv("AUDIT_LOG_PATH", "data/audit.jsonl")
+
+	cfg.ForwardSessionsPath = getEnv("FORWARD_SESSIONS_PATH", "data/forward_sessions.json")
+	cfg.ForwardSessionTTL = parseDuration("FORWARD_SESSION_TTL", getEnv("FORWARD_SESSION_TTL", "30m"))
+
 	return cfg
 }
 
+// parseIDs 解析逗号分隔的 Telegram 用户 ID，解析失败的项打印警告后跳过
+func parseIDs(key, value string) []int64 {
+	var ids []int64
+	for _, p := range strings.Split(value, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(p, 10, 64)
+		if err != nil {
+			log.Printf("⚠️ Warning: Invalid user ID in %s: %q", key, p)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// loadSchedules 扫描所有 CRAWL_<NAME>_<FIELD> 环境变量
+func loadSchedules() map[string]Schedule {
+	schedules := make(map[string]Schedule)
+	for _, kv := range os.Environ() {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(key, "CRAWL_") {
+			continue
+		}
+		rest := strings.TrimPrefix(key, "CRAWL_")
+		i := strings.LastIndex(rest, "_")
+		if i <= 0 {
+			continue
+		}
+		name := strings.ToLower(rest[:i])
+		value = strings.TrimSpace(value)
+
+		s := schedules[name]
+		switch rest[i+1:] {
+		case "INTERVAL":
+			s.Interval = parseDuration(key, value)
+		case "CRON":
+			s.Cron = value
+		case "JITTER":
+			s.Jitter = parseDuration(key, value)
+		case "DELAY":
+			s.Delay = parseDuration(key, value)
+		case "ENABLED":
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				log.Printf("⚠️ Warning: Invalid %s: %v", key, err)
+				continue
+			}
+			s.Enabled = &enabled
+		default:
+			continue
+		}
+		schedules[name] = s
+	}
+	return schedules
+}
+
+func parseDuration(key, value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("⚠️ Warning: Invalid %s: %v", key, err)
+		return 0
+	}
+	return d
+}
+
 func getEnv(key, fallback string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
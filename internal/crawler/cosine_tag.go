@@ -3,6 +3,7 @@ package crawler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -10,7 +11,7 @@ import (
 
 	"my-bot-go/internal/config"
 	"my-bot-go/internal/database"
-	"my-bot-go/internal/telegram"
+	"my-bot-go/internal/scheduler"
 
 	"github.com/go-resty/resty/v2"
 )
@@ -30,194 +31,233 @@ type CosineImage struct {
 	Platform  string   `json:"platform"`
 }
 
-func StartCosineTag(ctx context.Context, cfg *config.Config, db *database.D1Client, botHandler *telegram.BotHandler) {
-	if len(cfg.CosineTags) == 0 {
-		log.Printf("⚠️ No CosineTags configured. Skipping Cosine Crawler.")
-		return
-	}
-
-	client := resty.New()
-	client.SetTimeout(30 * time.Second)
+func init() {
+	Register(Entry{
+		Name:     "cosine",
+		New:      NewCosineSource,
+		Delay:    10 * time.Minute,
+		Interval: 127 * time.Minute,
+		// /crawl cosine <标签...>：每个参数是一个标签，替换 COSINE_TAGS
+		Override: func(cfg *config.Config, args []string) error {
+			cfg.CosineTags = args
+			return nil
+		},
+	})
+}
 
-	indexHeaders := map[string]string{
+var (
+	cosineIndexHeaders = map[string]string{
 		"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36",
 		"Referer":    "https://pic.cosine.ren/",
 	}
 
-	pixivHeaders := map[string]string{
+	cosinePixivHeaders = map[string]string{
 		"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36",
 		"Referer":    "https://www.pixiv.net/",
 	}
+)
+
+// CosineSource 按 COSINE_TAGS 巡逻 pic.cosine.ren
+type CosineSource struct {
+	cfg    *config.Config
+	db     *database.DB
+	client *resty.Client
+}
+
+func NewCosineSource(cfg *config.Config, db *database.DB) (Source, error) {
+	if len(cfg.CosineTags) == 0 {
+		return nil, errors.New("no CosineTags configured")
+	}
+
+	client := resty.New()
+	client.SetTimeout(30 * time.Second)
+
+	log.Printf("🎯 Cosine Target Tags: %v", cfg.CosineTags)
+	log.Printf("📊 Cosine Limit Per Tag: %d", cfg.CosineLimitPerTag)
+
+	return &CosineSource{cfg: cfg, db: db, client: client}, nil
+}
 
-	log.Println("🚀 Starting Cosine Tag Crawler...")
-	log.Printf("🎯 Target Tags: %v", cfg.CosineTags)
-	log.Printf("📊 Limit Per Tag: %d", cfg.CosineLimitPerTag)
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			for _, tag := range cfg.CosineTags {
-				log.Printf("🏷️  Scanning Tag: %s", tag)
-				
-				processedCount := 0
-				start := 0
-				limit := 32
-
-				for processedCount < cfg.CosineLimitPerTag {
-					apiURL := "https://pic.cosine.ren/api/tag"
-					resp, err := client.R().
-						SetHeaders(indexHeaders).
-						SetQueryParams(map[string]string{
-							"tag":   tag,
-							"start": fmt.Sprintf("%d", start),
-							"limit": fmt.Sprintf("%d", limit),
-						}).Get(apiURL)
-
-					if err != nil || resp.StatusCode() != 200 {
-						log.Printf("❌ API Request Failed for tag %s: %v", tag, err)
-						break
-					}
-
-					var images []CosineImage
-					if err := json.Unmarshal(resp.Body(), &images); err != nil {
-						log.Printf("❌ JSON Unmarshal Failed: %v", err)
-						break
-					}
-
-					if len(images) == 0 {
-						log.Println("🏁 No more images for this tag.")
-						break
-					}
-
-					log.Printf("📄 Fetched %d images (start=%d)", len(images), start)
-
-					for _, img := range images {
-						if processedCount >= cfg.CosineLimitPerTag {
-							break
-						}
-
-						pidStr := img.PID
-						pagePart := "_p0" 
-						
-						// 尝试从文件名解析 _p1, _p2 等
-						if strings.Contains(img.Filename, "_p") {
-							start := strings.LastIndex(img.Filename, "_p")
-							if start != -1 {
-								rest := img.Filename[start:]
-								if dot := strings.Index(rest, "."); dot != -1 {
-									pagePart = rest[:dot]
-								} else {
-									pagePart = rest
-								}
-							}
-						}
-
-						// 构造标准 DB Key (无后缀)
-						dbKey := fmt.Sprintf("pixiv_%s%s", pidStr, pagePart)
-
-                        if db.CheckExists(dbKey) || 
-                           db.CheckExists(dbKey+".jpg") || 
-                           db.CheckExists(dbKey+".png") || 
-                           db.CheckExists(dbKey+".webp") {
-                             log.Printf("♻️ cosine-Skip %s (Already in DB)", dbKey)
-                            continue
-                        }
-						
-						var imgData []byte
-						var finalExt string = ".jpg"
-
-						// 1. 优先尝试 Pixiv 原链
-						downloadURL := img.RawURL
-						if downloadURL == "" {
-							downloadURL = img.ThumbURL
-						}
-
-						// 修正 extension
-						if img.Extension != "" {
-							finalExt = "." + img.Extension
-						}
-
-						log.Printf("⬇️  Downloading: %s (%s)", img.Title, dbKey)
-
-						dlHeaders := indexHeaders
-						if strings.Contains(downloadURL, "pximg.net") {
-							dlHeaders = pixivHeaders
-						}
-
-						imgResp, err := client.R().SetHeaders(dlHeaders).Get(downloadURL)
-						success := (err == nil && imgResp.StatusCode() == 200)
-
-						// 2. 备用方案
-						if !success {
-							log.Printf("⚠️ Primary Source Failed, trying Cosine Backup...")
-							
-							platformDir := "pixiv"
-							if strings.Contains(img.RawURL, "twimg.com") || img.Platform == "twitter" {
-								platformDir = "twitter"
-							}
-
-							backupBase := fmt.Sprintf("https://backblaze.cosine.ren/pic/origin/%s/", platformDir)
-							
-							// 策略 A: 原始文件名
-							backupURL := backupBase + img.Filename
-							log.Printf("🔄 Trying Backup A: %s", backupURL)
-							imgResp, err = client.R().SetHeaders(indexHeaders).Get(backupURL)
-
-							if err == nil && imgResp.StatusCode() == 200 {
-								success = true
-							} else {
-								// 策略 B: 强制 .webp
-								nameNoExt := img.Filename
-								if idx := strings.LastIndex(img.Filename, "."); idx != -1 {
-									nameNoExt = img.Filename[:idx]
-								}
-								backupURL = backupBase + nameNoExt + ".webp"
-								log.Printf("🔄 Trying Backup B: %s", backupURL)
-								imgResp, err = client.R().SetHeaders(indexHeaders).Get(backupURL)
-								
-								if err == nil && imgResp.StatusCode() == 200 {
-									success = true
-									finalExt = ".webp"
-								}
-							}
-						}
-
-						if !success {
-							log.Printf("❌ All sources failed for: %s, Skipping.", dbKey)
-							continue
-						}
-						
-						imgData = imgResp.Body()
-
-						cleanTitle := strings.TrimSpace(img.Title)
-						tagsStr := strings.Join(img.Tags, " #")
-						caption := fmt.Sprintf("Title: %s\nArtist: %s\nTags: #%s\nSource: %s",
-							cleanTitle, img.Author, tagsStr, "pic.cosine.ren")
-						
-						// 构造发给 TG 的文件名 (必须带后缀，骗过 TG)
-						sendID := dbKey + finalExt
-
-						// 发送
-						botHandler.ProcessAndSend(ctx, imgData, sendID, strings.Join(img.Tags, " "), caption, img.Author, "pixiv", img.Width, img.Height)
-                        
-                        // 存库 (存标准 Key，无后缀)
-                        // 注意：显式调用 PushHistory，防止 ProcessAndSend 没存对
-                        db.History[dbKey] = true
-                        db.PushHistory()
-                        
-                        processedCount++
-                        time.Sleep(18 * time.Second)
-					}
-					
-					start += limit
-					time.Sleep(3 * time.Second)
+func (s *CosineSource) Name() string { return "cosine" }
+
+func (s *CosineSource) List(ctx context.Context) ([]Candidate, error) {
+	var candidates []Candidate
+
+	for _, tag := range s.cfg.CosineTags {
+		log.Printf("🏷️  Scanning Tag: %s", tag)
+
+		found := 0
+		start := 0
+		limit := 32
+
+		for found < s.cfg.CosineLimitPerTag {
+			apiURL := "https://pic.cosine.ren/api/tag"
+			resp, err := s.client.R().
+				SetContext(ctx).
+				SetHeaders(cosineIndexHeaders).
+				SetQueryParams(map[string]string{
+					"tag":   tag,
+					"start": fmt.Sprintf("%d", start),
+					"limit": fmt.Sprintf("%d", limit),
+				}).Get(apiURL)
+
+			if err != nil || resp.StatusCode() != 200 {
+				log.Printf("❌ API Request Failed for tag %s: %v", tag, err)
+				break
+			}
+
+			var images []CosineImage
+			if err := json.Unmarshal(resp.Body(), &images); err != nil {
+				log.Printf("❌ JSON Unmarshal Failed: %v", err)
+				break
+			}
+
+			if len(images) == 0 {
+				log.Println("🏁 No more images for this tag.")
+				break
+			}
+
+			log.Printf("📄 Fetched %d images (start=%d)", len(images), start)
+
+			for _, img := range images {
+				if found >= s.cfg.CosineLimitPerTag {
+					break
+				}
+
+				dbKey := cosineDBKey(img)
+				// 旧版本存库时 ID 带着后缀，一起查
+				keys := []string{dbKey, dbKey + ".jpg", dbKey + ".png", dbKey + ".webp"}
+				if seenAny(s.db, keys) {
+					log.Printf("♻️ cosine-Skip %s (Already in DB)", dbKey)
+					continue
 				}
+
+				candidates = append(candidates, Candidate{Keys: keys, Label: dbKey, Data: img})
+				found++
+			}
+
+			start += limit
+			if !scheduler.Sleep(ctx, 3*time.Second) {
+				return candidates, ctx.Err()
 			}
+		}
+	}
+
+	return candidates, nil
+}
+
+func (s *CosineSource) Fetch(ctx context.Context, c Candidate) (*Work, error) {
+	img := c.Data.(CosineImage)
+	dbKey := cosineDBKey(img)
+
+	cleanTitle := strings.TrimSpace(img.Title)
+	tagsStr := strings.Join(img.Tags, " #")
+	caption := fmt.Sprintf("Title: %s\nArtist: %s\nTags: #%s\nSource: %s",
+		cleanTitle, img.Author, tagsStr, "pic.cosine.ren")
+
+	pageIndex := 0
+	if i := strings.LastIndex(dbKey, "_p"); i != -1 {
+		fmt.Sscanf(dbKey[i+2:], "%d", &pageIndex)
+	}
+
+	return &Work{
+		Title:     cleanTitle,
+		Artist:    img.Author,
+		Tags:      strings.Join(img.Tags, " "),
+		Source:    cosinePlatform(img),
+		SourceURL: cosineSourceURL(img),
+		ArtworkID: img.PID,
+		Pages: []Page{{
+			ID:      dbKey,
+			Caption: caption,
+			Width:   img.Width,
+			Height:  img.Height,
+			Index:   pageIndex,
+			Data:    img,
+		}},
+	}, nil
+}
+
+func (s *CosineSource) Download(ctx context.Context, p Page) ([]byte, error) {
+	img := p.Data.(CosineImage)
+
+	// 1. 优先尝试 Pixiv 原链
+	downloadURL := img.RawURL
+	if downloadURL == "" {
+		downloadURL = img.ThumbURL
+	}
+
+	dlHeaders := cosineIndexHeaders
+	if strings.Contains(downloadURL, "pximg.net") {
+		dlHeaders = cosinePixivHeaders
+	}
+
+	imgResp, err := s.client.R().SetContext(ctx).SetHeaders(dlHeaders).Get(downloadURL)
+	if err == nil && imgResp.StatusCode() == 200 {
+		return imgResp.Body(), nil
+	}
+
+	// 2. 备用方案
+	log.Printf("⚠️ Primary Source Failed, trying Cosine Backup...")
 
-			log.Println("😴 Cosine Crawler Cycle Done. Sleeping 127 Mins...")
-			time.Sleep(127 * time.Minute)
+	backupBase := fmt.Sprintf("https://backblaze.cosine.ren/pic/origin/%s/", cosinePlatform(img))
+
+	// 策略 A: 原始文件名
+	backupURL := backupBase + img.Filename
+	log.Printf("🔄 Trying Backup A: %s", backupURL)
+	imgResp, err = s.client.R().SetContext(ctx).SetHeaders(cosineIndexHeaders).Get(backupURL)
+	if err == nil && imgResp.StatusCode() == 200 {
+		return imgResp.Body(), nil
+	}
+
+	// 策略 B: 强制 .webp
+	nameNoExt := img.Filename
+	if idx := strings.LastIndex(img.Filename, "."); idx != -1 {
+		nameNoExt = img.Filename[:idx]
+	}
+	backupURL = backupBase + nameNoExt + ".webp"
+	log.Printf("🔄 Trying Backup B: %s", backupURL)
+	imgResp, err = s.client.R().SetContext(ctx).SetHeaders(cosineIndexHeaders).Get(backupURL)
+	if err == nil && imgResp.StatusCode() == 200 {
+		return imgResp.Body(), nil
+	}
+
+	return nil, fmt.Errorf("all sources failed for %s", cosineDBKey(img))
+}
+
+// cosinePlatform 返回图片的原站，Cosine 同时收录 Pixiv 和 Twitter 的图
+func cosinePlatform(img CosineImage) string {
+	if img.Platform == "twitter" || strings.Contains(img.RawURL, "twimg.com") {
+		return "twitter"
+	}
+	return "pixiv"
+}
+
+// cosineSourceURL 返回原作品页面，Twitter 的 PID 是推文 ID
+func cosineSourceURL(img CosineImage) string {
+	if cosinePlatform(img) == "twitter" {
+		return "https://x.com/i/status/" + img.PID
+	}
+	return "https://www.pixiv.net/artworks/" + img.PID
+}
+
+// cosineDBKey 构造标准 DB Key (无后缀)
+// Twitter 的图也沿用 pixiv_ 前缀，改掉会让已经发过的图被当成新图
+func cosineDBKey(img CosineImage) string {
+	pagePart := "_p0"
+
+	// 尝试从文件名解析 _p1, _p2 等
+	if strings.Contains(img.Filename, "_p") {
+		start := strings.LastIndex(img.Filename, "_p")
+		if start != -1 {
+			rest := img.Filename[start:]
+			if dot := strings.Index(rest, "."); dot != -1 {
+				pagePart = rest[:dot]
+			} else {
+				pagePart = rest
+			}
 		}
 	}
+
+	return fmt.Sprintf("pixiv_%s%s", img.PID, pagePart)
 }
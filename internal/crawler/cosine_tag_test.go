@@ -0,0 +1,48 @@
+package crawler
+
+import (
+	"testing"
+
+	"my-bot-go/internal/canonical"
+)
+
+func TestCosineSource(t *testing.T) {
+	tests := []struct {
+		img          CosineImage
+		platform     string
+		sourceURL    string
+		canonicalID  string
+		canonicalFor int
+	}{
+		{
+			img:       CosineImage{PID: "123", Platform: "pixiv", RawURL: "https://i.pximg.net/img-original/img/123_p1.png"},
+			platform:  "pixiv",
+			sourceURL: "https://www.pixiv.net/artworks/123",
+			// 原站爬虫发过的图可以互相去重
+			canonicalID:  "pixiv_123_p1",
+			canonicalFor: 1,
+		},
+		{
+			img:       CosineImage{PID: "1790000000000000000", Platform: "twitter"},
+			platform:  "twitter",
+			sourceURL: "https://x.com/i/status/1790000000000000000",
+		},
+		{
+			img:       CosineImage{PID: "42", RawURL: "https://pbs.twimg.com/media/abc.jpg"},
+			platform:  "twitter",
+			sourceURL: "https://x.com/i/status/42",
+		},
+	}
+	for _, tt := range tests {
+		if got := cosinePlatform(tt.img); got != tt.platform {
+			t.Errorf("cosinePlatform(%+v) = %q, want %q", tt.img, got, tt.platform)
+		}
+		url := cosineSourceURL(tt.img)
+		if url != tt.sourceURL {
+			t.Errorf("cosineSourceURL(%+v) = %q, want %q", tt.img, url, tt.sourceURL)
+		}
+		if got := canonical.FromURL(url, tt.canonicalFor); got != tt.canonicalID {
+			t.Errorf("canonical.FromURL(%q) = %q, want %q", url, got, tt.canonicalID)
+		}
+	}
+}
@@ -3,11 +3,11 @@ package crawler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"my-bot-go/internal/config"
 	"my-bot-go/internal/database"
-	"my-bot-go/internal/telegram"
 	"net/url" // ✅ 必须加这个包
 	"strings"
 	"time"
@@ -24,13 +24,33 @@ type DanbooruPost struct {
 	FileURL      string `json:"file_url"`
 	LargeFileURL string `json:"large_file_url"`
 	FileExt      string `json:"file_ext"` // jpg, png, mp4, webm...
+	Rating       string `json:"rating"`   // g / s / q / e
 }
 
-// StartDanbooru 自动按标签巡逻 Danbooru
-func StartDanbooru(ctx context.Context, cfg *config.Config, db *database.D1Client, botHandler *telegram.BotHandler) {
+// 还未完善，默认不启动
+func init() {
+	Register(Entry{
+		Name:     "danbooru",
+		New:      NewDanbooruSource,
+		Interval: 60 * time.Minute,
+		Disabled: true,
+		// /crawl danbooru <标签...>：替换 DANBOORU_TAGS
+		Override: func(cfg *config.Config, args []string) error {
+			cfg.DanbooruTags = strings.Join(args, " ")
+			return nil
+		},
+	})
+}
+
+// DanbooruSource 自动按标签巡逻 Danbooru
+type DanbooruSource struct {
+	cfg    *config.Config
+	client *resty.Client
+}
+
+func NewDanbooruSource(cfg *config.Config, db *database.DB) (Source, error) {
 	if cfg.DanbooruTags == "" || cfg.DanbooruLimit <= 0 {
-		log.Println("Danbooru disabled (no tags or limit).")
-		return
+		return nil, errors.New("no tags or limit")
 	}
 
 	client := resty.New().
@@ -44,102 +64,95 @@ func StartDanbooru(ctx context.Context, cfg *config.Config, db *database.D1Clien
 	} else {
 		log.Println("⚠️ Danbooru API Key missing (Cloudflare might block requests)")
 	}
-	
+
 	// 设置 User-Agent 和 Accept 头
 	client.SetHeader("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
 	client.SetHeader("Accept", "application/json")
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			log.Println("🔍 Checking Danbooru...")
-
-			// ✅ 关键修正：对 Tags 进行 URL 编码，防止空格导致 URL 断裂
-			encodedTags := url.QueryEscape(cfg.DanbooruTags)
-
-			// 构造查询 URL
-			targetURL := fmt.Sprintf(
-				"https://danbooru.donmai.us/posts.json?limit=%d&tags=%s",
-				cfg.DanbooruLimit,
-				encodedTags,
-			)
-
-			resp, err := client.R().Get(targetURL)
-			if err != nil {
-				log.Printf("Danbooru Error: %v", err)
-				time.Sleep(1 * time.Minute)
-				continue
-			}
-
-			// 如果遇到非 200 状态码 (比如 403 Forbidden)，打印 Body 方便调试
-			if resp.StatusCode() != 200 {
-				log.Printf("⚠️ Danbooru API Status: %d | Body: %s", resp.StatusCode(), string(resp.Body()))
-				time.Sleep(1 * time.Minute)
-				continue
-			}
-
-			var posts []DanbooruPost
-			if err := json.Unmarshal(resp.Body(), &posts); err != nil {
-				log.Printf("Danbooru JSON Error: %v", err)
-				time.Sleep(1 * time.Minute)
-				continue
-			}
-
-			for _, post := range posts {
-				// 跳过无图 / 视频 / zip 等
-				if post.FileURL == "" || post.LargeFileURL == "" {
-					continue
-				}
-				ext := strings.ToLower(post.FileExt)
-				if ext == "mp4" || ext == "webm" || ext == "zip" || ext == "swf" {
-					continue
-				}
-
-				pid := fmt.Sprintf("danbooru_%d", post.ID)
-				if db.History[pid] {
-					continue
-				}
-
-				// 下载图片
-				imgURL := post.FileURL
-				log.Printf("⬇️ Downloading Danbooru: %d", post.ID)
-
-				imgResp, err := client.R().Get(imgURL)
-				if err != nil || imgResp.StatusCode() != 200 {
-					log.Printf("Danbooru download error: %v", err)
-					continue
-				}
-
-				tagsStr := post.TagString
-				caption := fmt.Sprintf(
-					"Danbooru: %d\nTags: #%s",
-					post.ID,
-					strings.ReplaceAll(tagsStr, " ", " #"),
-				)
-
-				// 发送
-				botHandler.ProcessAndSend(
-					ctx,
-					imgResp.Body(),
-					pid,
-					tagsStr,
-					caption,
-					"",
-					"danbooru",
-					post.ImageWidth,
-					post.ImageHeight,
-				)
-
-				// 每发完一张图，立刻同步到云端
-				db.PushHistory()
-
-				time.Sleep(3 * time.Second)
-			}
-
-			log.Println("😴 Danbooru Done. Sleeping 10m...")
-			time.Sleep(60 * time.Minute)
+	return &DanbooruSource{cfg: cfg, client: client}, nil
+}
+
+func (s *DanbooruSource) Name() string { return "danbooru" }
+
+func (s *DanbooruSource) List(ctx context.Context) ([]Candidate, error) {
+	log.Println("🔍 Checking Danbooru...")
+
+	// ✅ 关键修正：对 Tags 进行 URL 编码，防止空格导致 URL 断裂
+	encodedTags := url.QueryEscape(s.cfg.DanbooruTags)
+
+	// 构造查询 URL
+	targetURL := fmt.Sprintf(
+		"https://danbooru.donmai.us/posts.json?limit=%d&tags=%s",
+		s.cfg.DanbooruLimit,
+		encodedTags,
+	)
+
+	resp, err := s.client.R().SetContext(ctx).Get(targetURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// 如果遇到非 200 状态码 (比如 403 Forbidden)，打印 Body 方便调试
+	if resp.StatusCode() != 200 {
+		return nil, fmt.Errorf("status %d | Body: %s", resp.StatusCode(), string(resp.Body()))
+	}
+
+	var posts []DanbooruPost
+	if err := json.Unmarshal(resp.Body(), &posts); err != nil {
+		return nil, err
+	}
+
+	var candidates []Candidate
+	for _, post := range posts {
+		// 跳过无图 / 视频 / zip 等
+		if post.FileURL == "" || post.LargeFileURL == "" {
+			continue
 		}
+		ext := strings.ToLower(post.FileExt)
+		if ext == "mp4" || ext == "webm" || ext == "zip" || ext == "swf" {
+			continue
+		}
+
+		pid := fmt.Sprintf("danbooru_%d", post.ID)
+		candidates = append(candidates, Candidate{Keys: []string{pid}, Label: pid, Data: post})
+	}
+
+	return candidates, nil
+}
+
+func (s *DanbooruSource) Fetch(ctx context.Context, c Candidate) (*Work, error) {
+	post := c.Data.(DanbooruPost)
+
+	tagsStr := post.TagString
+	caption := fmt.Sprintf(
+		"Danbooru: %d\nTags: #%s",
+		post.ID,
+		strings.ReplaceAll(tagsStr, " ", " #"),
+	)
+
+	return &Work{
+		Tags:      tagsStr,
+		Source:    "danbooru",
+		SourceURL: fmt.Sprintf("https://danbooru.donmai.us/posts/%d", post.ID),
+		ArtworkID: fmt.Sprintf("%d", post.ID),
+		R18:       post.Rating == "e",
+		Pages: []Page{{
+			ID:      c.Keys[0],
+			Ref:     post.FileURL,
+			Caption: caption,
+			Width:   post.ImageWidth,
+			Height:  post.ImageHeight,
+		}},
+	}, nil
+}
+
+func (s *DanbooruSource) Download(ctx context.Context, p Page) ([]byte, error) {
+	imgResp, err := s.client.R().SetContext(ctx).Get(p.Ref)
+	if err != nil {
+		return nil, err
+	}
+	if imgResp.StatusCode() != 200 {
+		return nil, fmt.Errorf("status %d", imgResp.StatusCode())
 	}
+	return imgResp.Body(), nil
 }
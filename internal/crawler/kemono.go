@@ -1,17 +1,15 @@
 package crawler
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"image"
 	_ "image/jpeg"
 	_ "image/png"
 	"log"
 	"my-bot-go/internal/config"
 	"my-bot-go/internal/database"
-	"my-bot-go/internal/telegram"
 	"path"
 	"strings"
 	"time"
@@ -39,99 +37,101 @@ type KemonoPostResp struct {
 	} `json:"previews"`
 }
 
-func StartKemono(ctx context.Context, cfg *config.Config, db *database.D1Client, botHandler *telegram.BotHandler) {
+// 还未完善，默认不启动
+func init() {
+	Register(Entry{
+		Name:     "kemono",
+		New:      NewKemonoSource,
+		Interval: 10 * time.Minute,
+		Disabled: true,
+	})
+}
+
+// kemonoRef 是 Kemono 候选作品的定位信息
+type kemonoRef struct {
+	service, uid, postID string
+}
+
+// KemonoSource 按 KEMONO_SERVICES 中配置的创作者巡逻 kemono.cr
+type KemonoSource struct {
+	cfg    *config.Config
+	client *resty.Client
+}
+
+func NewKemonoSource(cfg *config.Config, db *database.DB) (Source, error) {
 	if len(cfg.KemonoCreators) == 0 {
-		log.Println("Kemono disabled (no creators configured)")
-		return
+		return nil, errors.New("no creators configured")
 	}
 
 	client := resty.New().
 		SetTimeout(60 * time.Second).
 		SetRetryCount(3)
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			log.Println("🧩 Checking Kemono...")
-			// 移除 hasNew 变量，改为即时保存
-
-			for _, creator := range cfg.KemonoCreators {
-				service := strings.TrimSpace(creator.Service)
-				for _, rawUID := range creator.UserIDs {
-					uid := strings.TrimSpace(rawUID)
-					if uid == "" {
-						continue
-					}
-
-					listURL := fmt.Sprintf("https://kemono.cr/api/v1/%s/user/%s/posts", service, uid)
-					resp, err := client.R().Get(listURL)
-					if err != nil {
-						log.Printf("⚠️ Kemono list error (%s/%s): %v", service, uid, err)
-						continue
-					}
-
-					var posts []struct {
-						ID string `json:"id"`
-					}
-					if err := json.Unmarshal(resp.Body(), &posts); err != nil {
-						log.Printf("⚠️ Kemono list JSON error: %v", err)
-						continue
-					}
-
-					// 最新的在前面，一次只抓前 N 个防止刷屏
-					maxPosts := 5
-					for i, p := range posts {
-						if i >= maxPosts {
-							break
-						}
-						pid := fmt.Sprintf("kemono_%s_%s_%s", service, uid, p.ID)
-						// 粗略过滤，防止同一个 Post 反复进 fetchKemonoPost
-						if db.History[pid] {
-							continue
-						}
-						
-						// 进入详情抓取
-						err := fetchKemonoPost(ctx, client, service, uid, p.ID, pid, db, botHandler)
-						if err != nil {
-							log.Printf("❌ Failed to fetch post %s: %v", p.ID, err)
-						} else {
-							// 如果整个 Post 处理成功，把 Post ID 标记为已完成
-							db.History[pid] = true
-						}
-
-						// ✅ 【关键修改】每处理完一个 Post，立刻推送到 D1
-						db.PushHistory()
-						
-						time.Sleep(3 * time.Second)
-					}
-				}
+	return &KemonoSource{cfg: cfg, client: client}, nil
+}
+
+func (s *KemonoSource) Name() string { return "kemono" }
+
+func (s *KemonoSource) List(ctx context.Context) ([]Candidate, error) {
+	log.Println("🧩 Checking Kemono...")
+
+	var candidates []Candidate
+	for _, creator := range s.cfg.KemonoCreators {
+		service := strings.TrimSpace(creator.Service)
+		for _, rawUID := range creator.UserIDs {
+			uid := strings.TrimSpace(rawUID)
+			if uid == "" {
+				continue
+			}
+
+			listURL := fmt.Sprintf("https://kemono.cr/api/v1/%s/user/%s/posts", service, uid)
+			resp, err := s.client.R().SetContext(ctx).Get(listURL)
+			if err != nil {
+				log.Printf("⚠️ Kemono list error (%s/%s): %v", service, uid, err)
+				continue
 			}
 
-			// 循环结束后休息
-			log.Println("😴 Kemono Done. Sleeping 10m...")
-			time.Sleep(10 * time.Minute)
+			var posts []struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(resp.Body(), &posts); err != nil {
+				log.Printf("⚠️ Kemono list JSON error: %v", err)
+				continue
+			}
+
+			// 最新的在前面，一次只抓前 N 个防止刷屏
+			maxPosts := 5
+			for i, p := range posts {
+				if i >= maxPosts {
+					break
+				}
+				pid := fmt.Sprintf("kemono_%s_%s_%s", service, uid, p.ID)
+				candidates = append(candidates, Candidate{
+					// 粗略过滤，防止同一个 Post 反复进详情抓取
+					Keys:  []string{pid},
+					Label: pid,
+					Data:  kemonoRef{service: service, uid: uid, postID: p.ID},
+				})
+			}
 		}
 	}
+
+	return candidates, nil
 }
 
-func fetchKemonoPost(
-	ctx context.Context,
-	client *resty.Client,
-	service, uid, postID, basePID string,
-	db *database.D1Client,
-	botHandler *telegram.BotHandler,
-) error {
-	apiURL := fmt.Sprintf("https://kemono.cr/api/v1/%s/user/%s/post/%s", service, uid, postID)
-	resp, err := client.R().SetContext(ctx).Get(apiURL)
+func (s *KemonoSource) Fetch(ctx context.Context, c Candidate) (*Work, error) {
+	ref := c.Data.(kemonoRef)
+	basePID := c.Keys[0]
+
+	apiURL := fmt.Sprintf("https://kemono.cr/api/v1/%s/user/%s/post/%s", ref.service, ref.uid, ref.postID)
+	resp, err := s.client.R().SetContext(ctx).Get(apiURL)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var kResp KemonoPostResp
 	if err := json.Unmarshal(resp.Body(), &kResp); err != nil {
-		return err
+		return nil, err
 	}
 
 	// 构建 path -> server 映射
@@ -143,51 +143,50 @@ func fetchKemonoPost(
 		cdnMap[p.Path] = p.Server
 	}
 
-	// 下载每一张图
+	caption := fmt.Sprintf("Kemono: %s\nService: %s\nUser: %s\nPost: %s",
+		kResp.Post.Title, kResp.Post.Service, kResp.Post.User, kResp.Post.ID)
+
+	work := &Work{
+		Title:  kResp.Post.Title,
+		Artist: kResp.Post.User,
+		Tags:   strings.Join(kResp.Post.Tags, " "),
+		Source: "kemono",
+		// 整个 Post 处理完，把 Post ID 标记为已完成
+		Seen:      []string{basePID},
+		SourceURL: fmt.Sprintf("https://kemono.cr/%s/user/%s/post/%s", ref.service, ref.uid, ref.postID),
+		ArtworkID: ref.postID,
+	}
+
 	for idx, att := range kResp.Post.Attachments {
 		ext := strings.ToLower(path.Ext(att.Path))
 		if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".webp" {
 			continue
 		}
 
-		// 构建唯一的子图 ID
-		subPID := fmt.Sprintf("%s_p%d", basePID, idx)
-		
-		// 检查子图是否发过（断点续传的关键）
-		if db.History[subPID] {
-			continue
-		}
-
 		server := cdnMap[att.Path]
 		if server == "" {
 			server = "https://n4.kemono.cr"
 		}
-		imgURL := server + "/data" + att.Path
 
-		log.Printf("⬇️ Downloading Kemono: %s", imgURL)
-		imgResp, err := client.R().SetContext(ctx).Get(imgURL)
-		if err != nil || imgResp.StatusCode() != 200 {
-			log.Printf("❌ Kemono image error: %v", err)
-			continue
-		}
-		data := imgResp.Body()
-
-		// 解码宽高
-		width, height := 0, 0
-		if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
-			width, height = cfg.Width, cfg.Height
-		}
+		work.Pages = append(work.Pages, Page{
+			// 构建唯一的子图 ID，断点续传的关键
+			ID:      fmt.Sprintf("%s_p%d", basePID, idx),
+			Ref:     server + "/data" + att.Path,
+			Caption: caption,
+			Index:   idx,
+		})
+	}
 
-		caption := fmt.Sprintf("Kemono: %s\nService: %s\nUser: %s\nPost: %s",
-			kResp.Post.Title, kResp.Post.Service, kResp.Post.User, kResp.Post.ID)
-		tagsStr := strings.Join(kResp.Post.Tags, " ")
+	return work, nil
+}
 
-		botHandler.ProcessAndSend(ctx, data, subPID, tagsStr, caption, kResp.Post.User, "kemono", width, height)
-		
-		// ✅ 【关键修改】每张子图发完，立刻推送到 D1
-		// 这样如果图片很多，下载到一半挂了，下次也不会重复发前几张
-		db.PushHistory()
+func (s *KemonoSource) Download(ctx context.Context, p Page) ([]byte, error) {
+	imgResp, err := s.client.R().SetContext(ctx).Get(p.Ref)
+	if err != nil {
+		return nil, err
 	}
-
-	return nil
+	if imgResp.StatusCode() != 200 {
+		return nil, fmt.Errorf("status %d", imgResp.StatusCode())
+	}
+	return imgResp.Body(), nil
 }
@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"my-bot-go/internal/config"
+	"my-bot-go/internal/database"
+	"my-bot-go/internal/metrics"
+	"my-bot-go/internal/telegram"
+)
+
+// ErrBusy 表示这个图源正在运行 (定时任务或另一个 /crawl)
+var ErrBusy = errors.New("source is already running")
+
+// 同一个图源同一时间只跑一轮，避免两边同时发同一张图
+var (
+	locksMu sync.Mutex
+	locks   = make(map[string]*sync.Mutex)
+)
+
+func sourceLock(name string) *sync.Mutex {
+	locksMu.Lock()
+	defer locksMu.Unlock()
+	l := locks[name]
+	if l == nil {
+		l = &sync.Mutex{}
+		locks[name] = l
+	}
+	return l
+}
+
+// Manual 按需立刻跑一轮某个图源，给 /crawl 用 (实现 telegram.Crawler)
+type Manual struct {
+	cfg        *config.Config
+	db         *database.DB
+	botHandler *telegram.BotHandler
+}
+
+func NewManual(cfg *config.Config, db *database.DB, botHandler *telegram.BotHandler) *Manual {
+	return &Manual{cfg: cfg, db: db, botHandler: botHandler}
+}
+
+// Sources 返回所有已注册的图源，默认关闭的也可以手动跑
+func (m *Manual) Sources() []string {
+	var names []string
+	for _, e := range Entries() {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+// Crawl 用 args 覆盖配置后跑一轮 name，跑完才返回
+// 图源不存在、参数不对或者正在运行时直接返回错误，运行中的错误记在 stats 里
+func (m *Manual) Crawl(ctx context.Context, name string, args []string, stats *metrics.Source) error {
+	var entry *Entry
+	for _, e := range registry {
+		if e.Name == name {
+			e := e
+			entry = &e
+			break
+		}
+	}
+	if entry == nil {
+		return fmt.Errorf("unknown source %q", name)
+	}
+
+	cfg := m.cfg
+	if len(args) > 0 {
+		if entry.Override == nil {
+			return fmt.Errorf("%s does not take arguments", name)
+		}
+		c := *m.cfg
+		if err := entry.Override(&c, args); err != nil {
+			return err
+		}
+		cfg = &c
+	}
+
+	lock := sourceLock(name)
+	if !lock.TryLock() {
+		return ErrBusy
+	}
+	defer lock.Unlock()
+
+	src, err := entry.New(cfg, m.db)
+	if err != nil {
+		return err
+	}
+
+	RunOnce(ctx, src, entry.Pace, m.db, m.botHandler, stats)
+	return nil
+}
@@ -0,0 +1,29 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"my-bot-go/internal/config"
+)
+
+func TestManualCrawlBusy(t *testing.T) {
+	entries := Entries()
+	if len(entries) == 0 {
+		t.Skip("no sources registered")
+	}
+	name := entries[0].Name
+
+	lock := sourceLock(name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	m := NewManual(&config.Config{}, nil, nil)
+	if err := m.Crawl(context.Background(), name, nil, nil); !errors.Is(err, ErrBusy) {
+		t.Fatalf("Crawl while %s is running = %v, want ErrBusy", name, err)
+	}
+	if err := m.Crawl(context.Background(), "no-such-source", nil, nil); err == nil || errors.Is(err, ErrBusy) {
+		t.Fatalf("Crawl(unknown) = %v, want unknown source error", err)
+	}
+}
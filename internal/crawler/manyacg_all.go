@@ -11,7 +11,7 @@ import (
 	"my-bot-go/internal/config"
 	"my-bot-go/internal/database"
 	"my-bot-go/internal/manyacg"
-	"my-bot-go/internal/telegram"
+	"my-bot-go/internal/scheduler"
 
 	"github.com/go-resty/resty/v2"
 )
@@ -35,11 +35,11 @@ type ManyACGArtwork struct {
 	} `json:"artist"`
 	SourceType string `json:"source_type"`
 	Pictures   []struct {
-		ID       string `json:"id"`
-		Width    int    `json:"width"`
-		Height   int    `json:"height"`
-		Index    int    `json:"index"`
-		FileName string `json:"file_name"`
+		ID        string `json:"id"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+		Index     int    `json:"index"`
+		FileName  string `json:"file_name"`
 		Hash      string `json:"hash"`
 		ThumbHash string `json:"thumb_hash"`
 		Thumbnail string `json:"thumbnail"`
@@ -53,159 +53,150 @@ type ManyACGListResp struct {
 	Data    []ManyACGArtwork `json:"data"`
 }
 
-// StartManyACGAll
-func StartManyACGAll(ctx context.Context, cfg *config.Config, db *database.D1Client, botHandler *telegram.BotHandler) {
+func init() {
+	Register(Entry{
+		Name:     "manyacg_all",
+		New:      NewManyACGAllSource,
+		Delay:    15 * time.Minute,
+		Interval: 120 * time.Minute,
+	})
+}
+
+// ManyACGAllSource 每轮按列表接口扫描 ManyACG 前几页
+type ManyACGAllSource struct {
+	client *resty.Client
+}
+
+func NewManyACGAllSource(cfg *config.Config, db *database.DB) (Source, error) {
 	client := resty.New()
 	client.SetTimeout(60 * time.Second)
 	client.SetHeader("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
 
-     // 起始页
-    page := 1
-    // 每轮只扫前 10 页（根据你自己的需求调整）
-    maxPagePerRound := 10
+	return &ManyACGAllSource{client: client}, nil
+}
+
+func (s *ManyACGAllSource) Name() string { return "manyacg_all" }
+
+func (s *ManyACGAllSource) List(ctx context.Context) ([]Candidate, error) {
+	// 每轮只扫前 10 页（根据你自己的需求调整）
+	maxPagePerRound := 10
 
 	// r18 参数：0=非R18，1=R18，2=全部
 	r18Param := "2"
 
-	log.Println("🚀 Starting MtcACG All Crawler...")
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-
-		default:
-			    
-          if page > maxPagePerRound {
-              log.Printf("🔚 MtcACG one round done (1-%d), sleep 30m...", maxPagePerRound)
-              page = 1
-              time.Sleep(120 * time.Minute)
-              continue
-          }
-               
-			log.Printf("📜 MtcACG list page=%d, r18=%s ...", page, r18Param)
-
-			apiURL := "https://api.manyacg.top/v1/artwork/list"
-			resp, err := client.R().
-				SetQueryParams(map[string]string{
-					"page":      fmt.Sprintf("%d", page),
-					"page_size": "20",
-					"r18":       r18Param,
-					"limit":     "20",
-				}).
-				Get(apiURL)
-
-			if err != nil || resp.StatusCode() != 200 {
-				log.Printf("❌ ManyACG list error: %v (status=%d)", err, resp.StatusCode())
-				time.Sleep(15 * time.Second)
-				continue
-			}
+	var candidates []Candidate
+	for page := 1; page <= maxPagePerRound; page++ {
+		log.Printf("📜 MtcACG list page=%d, r18=%s ...", page, r18Param)
+
+		apiURL := "https://api.manyacg.top/v1/artwork/list"
+		resp, err := s.client.R().
+			SetContext(ctx).
+			SetQueryParams(map[string]string{
+				"page":      fmt.Sprintf("%d", page),
+				"page_size": "20",
+				"r18":       r18Param,
+				"limit":     "20",
+			}).
+			Get(apiURL)
+
+		if err != nil || resp.StatusCode() != 200 {
+			log.Printf("❌ ManyACG list error: %v (status=%d)", err, resp.StatusCode())
+			break
+		}
 
-			var list ManyACGListResp
-			if err := json.Unmarshal(resp.Body(), &list); err != nil {
-				log.Printf("❌ ManyACG list JSON error: %v", err)
-				time.Sleep(15 * time.Second)
-				continue
-			}
+		var list ManyACGListResp
+		if err := json.Unmarshal(resp.Body(), &list); err != nil {
+			log.Printf("❌ ManyACG list JSON error: %v", err)
+			break
+		}
 
-			if len(list.Data) == 0 {
-				log.Printf("🏁 ManyACG page %d has no data, reset to page=1 and sleep 30m...", page)
-				page = 1
-				time.Sleep(30 * time.Minute)
+		if len(list.Data) == 0 {
+			log.Printf("🏁 ManyACG page %d has no data, round done.", page)
+			break
+		}
+
+		for _, aw := range list.Data {
+			if len(aw.Pictures) == 0 {
 				continue
 			}
+			candidates = append(candidates, Candidate{Label: aw.ID, Data: aw})
+		}
 
-			for _, aw := range list.Data {
-				if len(aw.Pictures) == 0 {
-					continue
-				}
-
-				maxPages := len(aw.Pictures)
-				if maxPages > 50 {
-					maxPages = 50
-				}
-
-				for _, pic := range aw.Pictures {
-					if pic.Index >= maxPages {
-						continue
-					}
-
-					// 1. 截断 tags（避免 caption 太长）
-                 tags := aw.Tags
-                    maxTags := 20
-                    if len(tags) > maxTags {
-                    tags = tags[:maxTags]
-                    }
-
-						width := pic.Width
-					    height := pic.Height
-
-                         // 2. 压缩图片尺寸（避免 Telegram 尺寸超限）
-                        maxSize := 4000
-                        if width > maxSize || height > maxSize {
-							//求最大边
-                            longest := width
-                            if height > longest {
-                               longest = height
-                            }
-                            scale := float64(maxSize) / float64(longest)
-                            width = int(float64(width) * scale)
-                            height = int(float64(height) * scale)
-                            }
-
-					// 1) 唯一 PID: mtcacg_{artworkID}_p{index}
-					pid := fmt.Sprintf("mtcacg_%s_p%d", aw.ID, pic.Index)
-
-                    if db.CheckExists(pid) {
-                       // 可选：加一行提示
-                      log.Printf("♻️ MtcACG_all skip duplicate: %s", pid)
-                      continue
-                    }
-
-					// 3) 用 picture id 下载原图
-					imgData, err := manyacg.DownloadOriginal(ctx, pic.ID)
-					if err != nil || len(imgData) == 0 {
-						log.Printf("❌ MtcACG original failed: %v (picID=%s)", err, pic.ID)
-						continue
-					}
-
-					log.Printf("⬇️ ManyACG [%s] P%d (%dx%d, pid=%s)", aw.Title, pic.Index, width, height, pid)
-
-					// 4) 组装标签 / caption
-                    tagsStr := strings.Join(tags, " ")
-                    hashTags := ""
-                    if len(tags) > 0 {
-                        hashTags = "#" + strings.Join(tags, " #")
-                    }
-
-
-					source := "mtcacg"
-					if aw.SourceType != "" {
-						source = aw.SourceType
-					}
-
-					caption := fmt.Sprintf(
-						"MtcACG: %s [P%d/%d]\nArtist: %s\nSource: %s\nPlatform: %s\nTags: %s",
-						strings.TrimSpace(aw.Title),
-						pic.Index+1, len(aw.Pictures),
-						strings.TrimSpace(aw.Artist.Name),
-						aw.SourceURL,
-						source,
-						hashTags,
-					)
-
-
-					// 5) 发送并存库
-					botHandler.ProcessAndSend(ctx, imgData, pid, tagsStr, caption, aw.Artist.Name, source, width, height)
-					db.History[pid] = true
-					db.PushHistory()
-
-					time.Sleep(7 * time.Second)
-				}
-			}
+		if !scheduler.Sleep(ctx, 5*time.Second) {
+			return candidates, ctx.Err()
+		}
+	}
+
+	return candidates, nil
+}
+
+func (s *ManyACGAllSource) Fetch(ctx context.Context, c Candidate) (*Work, error) {
+	aw := c.Data.(ManyACGArtwork)
+
+	maxPages := len(aw.Pictures)
+	if maxPages > 50 {
+		maxPages = 50
+	}
+
+	// 截断 tags（避免 caption 太长）
+	tags := aw.Tags
+	maxTags := 20
+	if len(tags) > maxTags {
+		tags = tags[:maxTags]
+	}
+
+	hashTags := ""
+	if len(tags) > 0 {
+		hashTags = "#" + strings.Join(tags, " #")
+	}
+
+	source := "mtcacg"
+	if aw.SourceType != "" {
+		source = aw.SourceType
+	}
+
+	work := &Work{
+		Title:     strings.TrimSpace(aw.Title),
+		Artist:    aw.Artist.Name,
+		Tags:      strings.Join(tags, " "),
+		Source:    source,
+		SourceURL: aw.SourceURL,
+		ArtworkID: aw.ID,
+		R18:       aw.R18,
+	}
 
-			page++
-			time.Sleep(5 * time.Second)
+	for _, pic := range aw.Pictures {
+		if pic.Index >= maxPages {
+			continue
 		}
+
+		width, height := fitTelegramSize(pic.Width, pic.Height)
+
+		caption := fmt.Sprintf(
+			"MtcACG: %s [P%d/%d]\nArtist: %s\nSource: %s\nPlatform: %s\nTags: %s",
+			strings.TrimSpace(aw.Title),
+			pic.Index+1, len(aw.Pictures),
+			strings.TrimSpace(aw.Artist.Name),
+			aw.SourceURL,
+			source,
+			hashTags,
+		)
+
+		work.Pages = append(work.Pages, Page{
+			// 唯一 PID: mtcacg_{artworkID}_p{index}
+			ID:      fmt.Sprintf("mtcacg_%s_p%d", aw.ID, pic.Index),
+			Ref:     pic.ID,
+			Caption: caption,
+			Width:   width,
+			Height:  height,
+			Index:   pic.Index,
+		})
 	}
+
+	return work, nil
+}
+
+func (s *ManyACGAllSource) Download(ctx context.Context, p Page) ([]byte, error) {
+	// 用 picture id 下载原图
+	return manyacg.DownloadOriginal(ctx, p.Ref)
 }
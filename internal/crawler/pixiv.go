@@ -7,7 +7,6 @@ import (
 	"log"
 	"my-bot-go/internal/config"
 	"my-bot-go/internal/database"
-	"my-bot-go/internal/telegram"
 	"sort"
 	"strconv"
 	"strings"
@@ -32,11 +31,12 @@ type PixivPagesResp struct {
 
 type PixivDetailResp struct {
 	Body struct {
-		IllustId   string `json:"illustId"`
+		IllustId    string `json:"illustId"`
 		IllustTitle string `json:"illustTitle"`
-		UserName   string `json:"userName"`
-		IllustType int    `json:"illustType"` 
-		Tags       struct {
+		UserName    string `json:"userName"`
+		IllustType  int    `json:"illustType"`
+		XRestrict   int    `json:"xRestrict"` // 0=全年龄 1=R-18 2=R-18G
+		Tags        struct {
 			Tags []struct {
 				Tag string `json:"tag"`
 			} `json:"tags"`
@@ -44,7 +44,34 @@ type PixivDetailResp struct {
 	} `json:"body"`
 }
 
-func StartPixiv(ctx context.Context, cfg *config.Config, db *database.D1Client, botHandler *telegram.BotHandler) {
+func init() {
+	Register(Entry{
+		Name:     "pixiv",
+		New:      NewPixivSource,
+		Delay:    5 * time.Minute,
+		Interval: 73 * time.Minute,
+		Pace:     Pace{Page: 18 * time.Second}, // 防被ban
+		// /crawl pixiv 12345 67890：只巡逻这些画师，替换 PIXIV_ARTIST_IDS
+		Override: func(cfg *config.Config, args []string) error {
+			for _, id := range args {
+				if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+					return fmt.Errorf("invalid artist ID %q", id)
+				}
+			}
+			cfg.PixivArtistIDs = args
+			return nil
+		},
+	})
+}
+
+// PixivSource 按 PIXIV_ARTIST_IDS 巡逻画师的新作品 (Cookie 模式)
+type PixivSource struct {
+	cfg    *config.Config
+	db     *database.DB
+	client *resty.Client
+}
+
+func NewPixivSource(cfg *config.Config, db *database.DB) (Source, error) {
 	client := resty.New()
 	client.SetHeader("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
 	client.SetHeader("Referer", "https://www.pixiv.net/")
@@ -52,132 +79,148 @@ func StartPixiv(ctx context.Context, cfg *config.Config, db *database.D1Client,
 	// 建议把超时设长一点
 	client.SetTimeout(60 * time.Second)
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			log.Println("🍪 Checking Pixiv (Cookie Mode)...")
-
-			for _, uid := range cfg.PixivArtistIDs {
-				// 1. 获取画师所有作品列表
-				resp, err := client.R().Get(fmt.Sprintf("https://www.pixiv.net/ajax/user/%s/profile/all", uid))
-				if err != nil || resp.StatusCode() != 200 {
-					log.Printf("⚠️ Pixiv User %s Error: %v", uid, err)
-					continue
-				}
+	return &PixivSource{cfg: cfg, db: db, client: client}, nil
+}
 
-				var profile struct {
-					Body struct {
-						Illusts map[string]interface{} `json:"illusts"`
-					} `json:"body"`
-				}
-				json.Unmarshal(resp.Body(), &profile)
+func (s *PixivSource) Name() string { return "pixiv" }
 
-				var ids []int
-				for k := range profile.Body.Illusts {
-					if id, err := strconv.Atoi(k); err == nil {
-						ids = append(ids, id)
-					}
-				}
-				sort.Sort(sort.Reverse(sort.IntSlice(ids)))
-
-				count := 0
-				for i, id := range ids {
-
-				// 检查是否超过了回溯范围，太旧了，直接跳出循环
-                if cfg.PixivCrawlRange > 0 && i >= cfg.PixivCrawlRange {
-                 log.Printf("🛑 触达回溯限制 (%d/%d)，停止处理画师 %s 的旧图", i, cfg.PixivCrawlRange, uid)
-                 break 
-                 }
-					
-					if count >= cfg.PixivLimit {
-						break
-					}
-					
-					// 基础去重 
-					mainPid := fmt.Sprintf("pixiv_%d_p0", id)
-					if db.CheckExists(mainPid) {
-						continue
-					}
-
-					log.Printf("🔍 Processing Pixiv ID: %d", id)
-
-					// 2. 获取详情
-					detailResp, err := client.R().Get(fmt.Sprintf("https://www.pixiv.net/ajax/illust/%d", id))
-					if err != nil { continue }
-
-					var detail PixivDetailResp
-					if err := json.Unmarshal(detailResp.Body(), &detail); err != nil {
-						continue
-					}
-					
-					// 如果是动图，暂时跳过
-					if detail.Body.IllustType == 2 {
-						log.Printf("⚠️ Skip Ugoira (GIF): %d", id)
-						db.History[mainPid] = true
-						continue 
-					}
-
-					// Tags 拼接
-					var tagStrs []string
-					for _, t := range detail.Body.Tags.Tags {
-						tagStrs = append(tagStrs, t.Tag)
-					}
-					tagsStr := strings.Join(tagStrs, " ")
-					
-					// 关键升级：获取 Pages
-					pagesResp, err := client.R().Get(fmt.Sprintf("https://www.pixiv.net/ajax/illust/%d/pages?lang=zh", id))
-					if err != nil { continue }
-
-					var pages PixivPagesResp
-					json.Unmarshal(pagesResp.Body(), &pages)
-
-					if len(pages.Body) == 0 {
-						continue
-					}
-
-					maxPages := 50 
-					
-					for i, page := range pages.Body {
-						if i >= maxPages { break }
-
-						// 构造唯一的PID
-						subPid := fmt.Sprintf("pixiv_%d_p%d", id, i)
-						
-						// 双重检查
-						if db.CheckExists(subPid) {
-							continue
-						}
-
-						log.Printf("⬇️ Downloading Pixiv: %s (P%d)", detail.Body.IllustTitle, i)
-						
-						imgResp, err := client.R().Get(page.Urls.Original)
-						if err != nil || imgResp.StatusCode() != 200 {
-							log.Printf("❌ Download failed: %v", err)
-							continue
-						}
-
-						// 构造标题
-						caption := fmt.Sprintf("Pixiv: %s [P%d/%d]\nArtist: %s\nTags: #%s", 
-							detail.Body.IllustTitle, i+1, len(pages.Body), 
-							detail.Body.UserName, 
-							strings.ReplaceAll(tagsStr, " ", " #"))
-
-						botHandler.ProcessAndSend(ctx, imgResp.Body(), subPid, tagsStr, caption, detail.Body.UserName, "pixiv", page.Width, page.Height)
-						
-						time.Sleep(18 * time.Second) // 防被ban
-					}
-					
-					db.PushHistory()
-					
-					count++
-				}
+func (s *PixivSource) List(ctx context.Context) ([]Candidate, error) {
+	log.Println("🍪 Checking Pixiv (Cookie Mode)...")
+
+	var candidates []Candidate
+	for _, uid := range s.cfg.PixivArtistIDs {
+		// 1. 获取画师所有作品列表
+		resp, err := s.client.R().SetContext(ctx).Get(fmt.Sprintf("https://www.pixiv.net/ajax/user/%s/profile/all", uid))
+		if err != nil || resp.StatusCode() != 200 {
+			log.Printf("⚠️ Pixiv User %s Error: %v", uid, err)
+			continue
+		}
+
+		var profile struct {
+			Body struct {
+				Illusts map[string]interface{} `json:"illusts"`
+			} `json:"body"`
+		}
+		json.Unmarshal(resp.Body(), &profile)
+
+		var ids []int
+		for k := range profile.Body.Illusts {
+			if id, err := strconv.Atoi(k); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+
+		count := 0
+		for i, id := range ids {
+			// 检查是否超过了回溯范围，太旧了，直接跳出循环
+			if s.cfg.PixivCrawlRange > 0 && i >= s.cfg.PixivCrawlRange {
+				log.Printf("🛑 触达回溯限制 (%d/%d)，停止处理画师 %s 的旧图", i, s.cfg.PixivCrawlRange, uid)
+				break
 			}
 
-			
-			log.Println("😴 Pixiv Done. Sleeping 73m...")
-			time.Sleep(73 * time.Minute)
+			if count >= s.cfg.PixivLimit {
+				break
+			}
+
+			// 基础去重
+			mainPid := fmt.Sprintf("pixiv_%d_p0", id)
+			if s.db.CheckExists(mainPid) {
+				continue
+			}
+
+			candidates = append(candidates, Candidate{
+				Keys:  []string{mainPid},
+				Label: strconv.Itoa(id),
+				Data:  id,
+			})
+			count++
+		}
+	}
+
+	return candidates, nil
+}
+
+func (s *PixivSource) Fetch(ctx context.Context, c Candidate) (*Work, error) {
+	id := c.Data.(int)
+	log.Printf("🔍 Processing Pixiv ID: %d", id)
+
+	// 2. 获取详情
+	detailResp, err := s.client.R().SetContext(ctx).Get(fmt.Sprintf("https://www.pixiv.net/ajax/illust/%d", id))
+	if err != nil {
+		return nil, err
+	}
+
+	var detail PixivDetailResp
+	if err := json.Unmarshal(detailResp.Body(), &detail); err != nil {
+		return nil, err
+	}
+
+	// 如果是动图，暂时跳过
+	if detail.Body.IllustType == 2 {
+		log.Printf("⚠️ Skip Ugoira (GIF): %d", id)
+		return &Work{Seen: c.Keys}, nil
+	}
+
+	// Tags 拼接
+	var tagStrs []string
+	for _, t := range detail.Body.Tags.Tags {
+		tagStrs = append(tagStrs, t.Tag)
+	}
+	tagsStr := strings.Join(tagStrs, " ")
+
+	// 关键升级：获取 Pages
+	pagesResp, err := s.client.R().SetContext(ctx).Get(fmt.Sprintf("https://www.pixiv.net/ajax/illust/%d/pages?lang=zh", id))
+	if err != nil {
+		return nil, err
+	}
+
+	var pages PixivPagesResp
+	json.Unmarshal(pagesResp.Body(), &pages)
+
+	work := &Work{
+		Title:     detail.Body.IllustTitle,
+		Artist:    detail.Body.UserName,
+		Tags:      tagsStr,
+		Source:    "pixiv",
+		SourceURL: fmt.Sprintf("https://www.pixiv.net/artworks/%d", id),
+		ArtworkID: strconv.Itoa(id),
+		R18:       detail.Body.XRestrict > 0,
+	}
+
+	maxPages := 50
+	for i, page := range pages.Body {
+		if i >= maxPages {
+			break
 		}
+
+		// 构造标题
+		caption := fmt.Sprintf("Pixiv: %s [P%d/%d]\nArtist: %s\nTags: #%s",
+			detail.Body.IllustTitle, i+1, len(pages.Body),
+			detail.Body.UserName,
+			strings.ReplaceAll(tagsStr, " ", " #"))
+
+		work.Pages = append(work.Pages, Page{
+			// 构造唯一的PID
+			ID:      fmt.Sprintf("pixiv_%d_p%d", id, i),
+			Ref:     page.Urls.Original,
+			Caption: caption,
+			Width:   page.Width,
+			Height:  page.Height,
+			Index:   i,
+		})
+	}
+
+	return work, nil
+}
+
+func (s *PixivSource) Download(ctx context.Context, p Page) ([]byte, error) {
+	imgResp, err := s.client.R().SetContext(ctx).Get(p.Ref)
+	if err != nil {
+		return nil, err
+	}
+	if imgResp.StatusCode() != 200 {
+		return nil, fmt.Errorf("status %d", imgResp.StatusCode())
 	}
+	return imgResp.Body(), nil
 }
@@ -0,0 +1,295 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"log"
+	"sort"
+	"time"
+
+	"my-bot-go/internal/canonical"
+	"my-bot-go/internal/config"
+	"my-bot-go/internal/database"
+	"my-bot-go/internal/metrics"
+	"my-bot-go/internal/scheduler"
+	"my-bot-go/internal/telegram"
+)
+
+// Candidate 是 List 返回的候选作品
+type Candidate struct {
+	Keys  []string    // 去重用的 ID，任意一个已存在即整组跳过
+	Label string      // 日志里显示的名字
+	Data  interface{} // 源内部数据，原样交给 Fetch
+}
+
+// Work 是 Fetch 返回的作品详情
+type Work struct {
+	Title  string
+	Artist string
+	Tags   string // 空格分隔
+	Source string // 存库用的 platform 字段
+	Pages  []Page
+	Seen   []string // 整个作品处理完后额外写入历史的 ID
+
+	SourceURL string // 原作品页面
+	ArtworkID string // 原站的作品 ID
+	R18       bool
+}
+
+// Page 是作品里的一张图
+type Page struct {
+	ID      string // 存库用的 post ID
+	Ref     string // 下载地址，或源内部的图片 ID
+	Caption string
+	Tags    string // 这一页自己的标签，为空时用 Work.Tags (比如 yande 套图里每张图的标签不同)
+	Width   int    // 为 0 时下载后自动解析
+	Height  int
+	Index   int // 作品中的第几页，从 0 开始
+	Data    interface{}
+}
+
+// Source 是一个图源：列出候选、抓详情、下载每一页
+type Source interface {
+	Name() string
+	List(ctx context.Context) ([]Candidate, error)
+	Fetch(ctx context.Context, c Candidate) (*Work, error)
+	Download(ctx context.Context, p Page) ([]byte, error)
+}
+
+// Entry 是注册表里的一项
+type Entry struct {
+	Name     string
+	New      func(cfg *config.Config, db *database.DB) (Source, error)
+	Delay    time.Duration // 启动时的错峰延迟
+	Interval time.Duration // 默认的运行间隔
+	Pace     Pace          // 对图源限速，Telegram 的限流由发送队列处理
+	Disabled bool          // 默认不启动
+
+	// Override 把 /crawl 带的参数写进配置的副本，为 nil 时这个图源不接受参数
+	// 副本和原配置共用切片，要整个替换，不能原地修改
+	Override func(cfg *config.Config, args []string) error
+}
+
+// Pace 是爬虫两次请求之间的间隔，零值表示不等待
+type Pace struct {
+	Page time.Duration // 每发完一组图后
+	Work time.Duration // 每处理完一个作品后
+}
+
+var registry []Entry
+
+// Register 注册一个图源，一般在各自文件的 init 中调用
+func Register(e Entry) {
+	registry = append(registry, e)
+}
+
+// Entries 按启动延迟返回所有已注册的图源
+func Entries() []Entry {
+	list := make([]Entry, len(registry))
+	copy(list, registry)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Delay < list[j].Delay })
+	return list
+}
+
+// Jobs 把所有启用的图源转换成调度任务，CRAWL_<NAME>_* 配置覆盖注册时的默认值
+// 每个图源的运行情况记到 reg 里
+func Jobs(cfg *config.Config, db *database.DB, botHandler *telegram.BotHandler, reg *metrics.Registry) []scheduler.Job {
+	var jobs []scheduler.Job
+	for _, e := range Entries() {
+		sc := cfg.Schedules[e.Name]
+
+		enabled := !e.Disabled
+		if sc.Enabled != nil {
+			enabled = *sc.Enabled
+		}
+		if !enabled {
+			continue
+		}
+
+		src, err := e.New(cfg, db)
+		if err != nil {
+			log.Printf("⚠️ %s disabled: %v", e.Name, err)
+			continue
+		}
+
+		job := scheduler.Job{
+			Name:     e.Name,
+			Interval: e.Interval,
+			Cron:     sc.Cron,
+			Jitter:   cfg.CrawlJitter,
+			Delay:    e.Delay,
+		}
+		if sc.Interval > 0 {
+			job.Interval = sc.Interval
+		}
+		if sc.Jitter > 0 {
+			job.Jitter = sc.Jitter
+		}
+		if sc.Delay > 0 {
+			job.Delay = sc.Delay
+		}
+
+		name, pace := e.Name, e.Pace
+		lock := sourceLock(name)
+		stats := reg.Source(name)
+		job.OnScheduled = stats.SetNextRun
+		job.Run = func(ctx context.Context) {
+			// /crawl 正在跑同一个图源时跳过这次，不排队等它，否则跑完紧接着又来一轮
+			if !lock.TryLock() {
+				log.Printf("⏭️ [%s] /crawl is running this source, skipping scheduled run", name)
+				return
+			}
+			defer lock.Unlock()
+			RunOnce(ctx, src, pace, db, botHandler, stats)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
+
+// RunOnce 执行一轮：列出候选 -> 去重 -> 抓详情 -> 下载 -> 发送
+// 各环节的计数记到 stats 里，不需要统计时传 nil
+func RunOnce(ctx context.Context, src Source, pace Pace, db *database.DB, botHandler *telegram.BotHandler, stats *metrics.Source) {
+	log.Printf("🔄 Starting %s Loop...", src.Name())
+	stats.Start()
+
+	candidates, err := src.List(ctx)
+	if err != nil {
+		log.Printf("⚠️ %s list error: %v", src.Name(), err)
+		stats.End(err)
+		return
+	}
+	defer stats.End(nil)
+	stats.AddFound(len(candidates))
+
+	for _, c := range candidates {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if seenAny(db, c.Keys) {
+			// 把同组的其它 ID 也补进内存
+			db.MarkSeen(c.Keys...)
+			stats.AddSkipped(1)
+			continue
+		}
+
+		work, err := src.Fetch(ctx, c)
+		if err != nil {
+			log.Printf("❌ %s fetch %s failed: %v", src.Name(), c.Label, err)
+			stats.AddFailed(1)
+			stats.Error(err)
+			continue
+		}
+
+		// 多页作品攒满一组再发，ALBUM_MODE 开启时一组就是一个相册
+		// 有一页没下载下来或没发出去，整个作品就不算处理完，下次还会再试这些页
+		var album []telegram.AlbumItem
+		complete := true
+		sendAlbum := func() bool {
+			if len(album) == 0 {
+				return true
+			}
+			res := botHandler.ProcessAndSendAlbum(ctx, album)
+			stats.AddSent(res.Sent)
+			stats.AddSkipped(res.Skipped)
+			stats.AddFailed(res.Failed)
+			for i, it := range album {
+				if i < len(res.Items) && res.Items[i] != telegram.ItemUnsent {
+					db.MarkSeen(it.Rec.PostID)
+				} else {
+					complete = false
+				}
+			}
+			album = nil
+			return scheduler.Sleep(ctx, pace.Page)
+		}
+
+		for _, p := range work.Pages {
+			if db.CheckExists(p.ID) {
+				log.Printf("♻️ %s skip duplicate: %s", src.Name(), p.ID)
+				stats.AddSkipped(1)
+				continue
+			}
+
+			// 镜像站的图先换算成原站 ID，原站爬虫或别的镜像已经发过就不再下载
+			canonicalID := canonical.FromURL(work.SourceURL, p.Index)
+			if canonicalID != "" && canonicalID != p.ID && db.CheckExists(canonicalID) {
+				log.Printf("♻️ %s skip %s: already have it as %s", src.Name(), p.ID, canonicalID)
+				db.MarkSeen(p.ID)
+				stats.AddSkipped(1)
+				continue
+			}
+
+			log.Printf("⬇️ Downloading %s: %s", src.Name(), p.ID)
+			data, err := src.Download(ctx, p)
+			if err != nil || len(data) == 0 {
+				log.Printf("❌ %s download %s failed: %v", src.Name(), p.ID, err)
+				stats.AddFailed(1)
+				complete = false
+				if err != nil {
+					stats.Error(err)
+				}
+				continue
+			}
+
+			width, height := p.Width, p.Height
+			if width == 0 || height == 0 {
+				if conf, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+					width, height = conf.Width, conf.Height
+				}
+			}
+
+			tags := work.Tags
+			if p.Tags != "" {
+				tags = p.Tags
+			}
+
+			album = append(album, telegram.AlbumItem{Data: data, Rec: database.ImageRecord{
+				PostID:    p.ID,
+				Caption:   p.Caption,
+				Artist:    work.Artist,
+				Tags:      tags,
+				Width:     width,
+				Height:    height,
+				Platform:  work.Source,
+				SourceURL: work.SourceURL,
+				ArtworkID: work.ArtworkID,
+				PageIndex: p.Index,
+				R18:       work.R18,
+
+				CanonicalID: canonicalID,
+			}})
+			if len(album) >= botHandler.AlbumSize() && !sendAlbum() {
+				return
+			}
+		}
+		if !sendAlbum() {
+			return
+		}
+
+		if complete {
+			db.MarkSeen(work.Seen...)
+		} else {
+			log.Printf("⚠️ %s %s has pages not sent, will retry next run", src.Name(), c.Label)
+		}
+
+		// ✅ 每处理完一个作品，整批写库并保存历史到云端
+		db.Flush()
+		db.PushHistory()
+
+		if !scheduler.Sleep(ctx, pace.Work) {
+			return
+		}
+	}
+}
+
+func seenAny(db *database.DB, keys []string) bool {
+	for _, k := range keys {
+		if db.CheckExists(k) {
+			return true
+		}
+	}
+	return false
+}
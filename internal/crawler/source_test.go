@@ -0,0 +1,296 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"my-bot-go/internal/config"
+	"my-bot-go/internal/database"
+	"my-bot-go/internal/metrics"
+	"my-bot-go/internal/telegram"
+)
+
+// fakeTelegram 是假的 Bot API 服务器，按 caption 记录发到频道的图
+// RunOnce 测试里每一页的 caption 就是它的 post ID
+type fakeTelegram struct {
+	*httptest.Server
+
+	delay time.Duration // 每次 sendPhoto 之前等待
+
+	mu     sync.Mutex
+	nextID int
+	photos map[string]int  // caption -> sendPhoto 成功次数
+	fail   map[string]bool // 这些 caption 的 sendPhoto 返回 400
+}
+
+func newFakeTelegram(t *testing.T) *fakeTelegram {
+	f := &fakeTelegram{photos: make(map[string]int), fail: make(map[string]bool)}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeTelegram) handle(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseMultipartForm(32 << 20)
+	caption := r.FormValue("caption")
+	if path.Base(r.URL.Path) == "sendPhoto" {
+		time.Sleep(f.delay)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := f.nextID
+
+	w.Header().Set("Content-Type", "application/json")
+	switch path.Base(r.URL.Path) {
+	case "getMe":
+		fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"test","username":"test_bot"}}`)
+	case "sendPhoto":
+		if f.fail[caption] {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"ok":false,"error_code":400,"description":"Bad Request: injected"}`)
+			return
+		}
+		f.photos[caption]++
+		fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d,"date":0,"chat":{"id":-100,"type":"channel"},"photo":[{"file_id":"photo_%d","file_unique_id":"p%d","width":8,"height":8}]}}`, id, id, id)
+	case "sendDocument":
+		fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d,"date":0,"chat":{"id":-100,"type":"channel"},"document":{"file_id":"doc_%d","file_unique_id":"d%d"}}}`, id, id, id)
+	default:
+		fmt.Fprint(w, `{"ok":true,"result":true}`)
+	}
+}
+
+func (f *fakeTelegram) setFail(caption string, fail bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail[caption] = fail
+}
+
+func (f *fakeTelegram) sent() map[string]int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make(map[string]int, len(f.photos))
+	for k, v := range f.photos {
+		out[k] = v
+	}
+	return out
+}
+
+// newTestBot 返回连着 fakeTelegram、写本地 SQLite 的 DB 和 BotHandler
+func newTestBot(t *testing.T, tg *fakeTelegram) (*database.DB, *telegram.BotHandler) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{
+		BotToken:        "1:test",
+		TGAPIURL:        tg.URL,
+		ChannelID:       -100,
+		StoreBackend:    "sqlite",
+		SQLitePath:      filepath.Join(dir, "images.db"),
+		BatchSize:       1,
+		WriteQueuePath:  filepath.Join(dir, "pending.jsonl"),
+		UploadBackends:  []string{"telegram"},
+		TGRatePerMinute: 60000,
+	}
+	db, err := database.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	h, err := telegram.NewBot(cfg, db, metrics.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, h
+}
+
+// pagePNG 按 ID 生成一张独一无二的小图，同一个 ID 每次内容相同
+func pagePNG(id string) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	var sum uint32
+	for i, c := range []byte(id) {
+		sum = sum*31 + uint32(c) + uint32(i)
+	}
+	for x := 0; x < 8; x++ {
+		for y := 0; y < 8; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(sum >> (x % 3 * 8)), G: uint8(x * 32), B: uint8(y*32) ^ uint8(sum>>24), A: 0xFF})
+		}
+	}
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// fakeSource 列出固定的作品，每个作品的 Seen 是 "<work>"，页是 "<work>_p<i>"
+type fakeSource struct {
+	name  string
+	works map[string]int // 作品 -> 页数
+
+	mu           sync.Mutex
+	downloadFail map[string]bool
+}
+
+func (s *fakeSource) Name() string { return s.name }
+
+func (s *fakeSource) List(ctx context.Context) ([]Candidate, error) {
+	var list []Candidate
+	for w := range s.works {
+		list = append(list, Candidate{Keys: []string{w}, Label: w, Data: w})
+	}
+	return list, nil
+}
+
+func (s *fakeSource) Fetch(ctx context.Context, c Candidate) (*Work, error) {
+	w := c.Data.(string)
+	work := &Work{Source: "fake", Tags: "work_tag", Seen: []string{w}}
+	for i := 0; i < s.works[w]; i++ {
+		id := fmt.Sprintf("%s_p%d", w, i)
+		work.Pages = append(work.Pages, Page{ID: id, Caption: id, Index: i})
+	}
+	return work, nil
+}
+
+func (s *fakeSource) Download(ctx context.Context, p Page) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.downloadFail[p.ID] {
+		return nil, errors.New("injected download error")
+	}
+	return pagePNG(p.ID), nil
+}
+
+func TestRunOnceRetriesFailedPages(t *testing.T) {
+	tg := newFakeTelegram(t)
+	db, h := newTestBot(t, tg)
+	src := &fakeSource{
+		name:         "fake",
+		works:        map[string]int{"a": 3, "b": 2},
+		downloadFail: map[string]bool{"b_p1": true},
+	}
+	tg.setFail("a_p1", true)
+
+	stats := metrics.NewSource("fake")
+	RunOnce(context.Background(), src, Pace{}, db, h, stats)
+
+	for id, want := range map[string]bool{"a_p0": true, "a_p1": false, "a_p2": true, "a": false, "b_p0": true, "b_p1": false, "b": false} {
+		if got := db.IsSeen(id); got != want {
+			t.Errorf("after first run IsSeen(%s) = %v, want %v", id, got, want)
+		}
+	}
+	if st := stats.Stats(); st.Sent != 3 || st.Failed != 2 {
+		t.Errorf("first run stats = %+v, want 3 sent and 2 failed", st)
+	}
+
+	// 故障恢复后再跑一轮，只补发失败的页
+	tg.setFail("a_p1", false)
+	src.mu.Lock()
+	src.downloadFail = nil
+	src.mu.Unlock()
+	RunOnce(context.Background(), src, Pace{}, db, h, stats)
+
+	for _, id := range []string{"a", "a_p1", "b", "b_p1"} {
+		if !db.IsSeen(id) {
+			t.Errorf("after retry %s is not seen", id)
+		}
+	}
+	for _, id := range []string{"a_p0", "a_p1", "a_p2", "b_p0", "b_p1"} {
+		if n := tg.sent()[id]; n != 1 {
+			t.Errorf("%s sent %d times, want 1", id, n)
+		}
+	}
+}
+
+func TestRunOncePageTags(t *testing.T) {
+	tg := newFakeTelegram(t)
+	db, h := newTestBot(t, tg)
+	src := &tagSource{fakeSource{name: "fake", works: map[string]int{"t": 2}}}
+
+	RunOnce(context.Background(), src, Pace{}, db, h, nil)
+
+	for id, want := range map[string]string{"t_p0": "own_tag", "t_p1": "work_tag"} {
+		rec, err := db.GetImage(id)
+		if err != nil || rec == nil {
+			t.Fatalf("GetImage(%s) = %v, %v", id, rec, err)
+		}
+		if rec.Tags != want {
+			t.Errorf("%s tags = %q, want %q", id, rec.Tags, want)
+		}
+	}
+}
+
+// tagSource 只给第一页设置自己的标签
+type tagSource struct{ fakeSource }
+
+func (s *tagSource) Fetch(ctx context.Context, c Candidate) (*Work, error) {
+	work, err := s.fakeSource.Fetch(ctx, c)
+	if err == nil && len(work.Pages) > 0 {
+		work.Pages[0].Tags = "own_tag"
+	}
+	return work, err
+}
+
+func TestRunOncePace(t *testing.T) {
+	tg := newFakeTelegram(t)
+	db, h := newTestBot(t, tg)
+	src := &fakeSource{name: "fake", works: map[string]int{"x": 2}}
+
+	start := time.Now()
+	RunOnce(context.Background(), src, Pace{Page: 50 * time.Millisecond, Work: 100 * time.Millisecond}, db, h, nil)
+	// 两页各等一次 Page，作品结束等一次 Work
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("RunOnce took %s, want at least 200ms of pacing", elapsed)
+	}
+	if sent := tg.sent(); len(sent) != 2 || sent["x_p0"] != 1 || sent["x_p1"] != 1 {
+		t.Fatalf("sent = %v, want x_p0 and x_p1 once", sent)
+	}
+}
+
+// 几个爬虫同时跑，列出的作品互相重叠 (比如镜像站和原站)，每一页只能发一次
+func TestRunOnceConcurrentCrawlers(t *testing.T) {
+	tg := newFakeTelegram(t)
+	tg.delay = 20 * time.Millisecond // 让上传互相重叠
+	db, h := newTestBot(t, tg)
+
+	shared := map[string]int{"s1": 3, "s2": 2, "s3": 1}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		works := map[string]int{fmt.Sprintf("own%d", i): 2}
+		for w, n := range shared {
+			works[w] = n
+		}
+		src := &fakeSource{name: fmt.Sprintf("fake%d", i), works: works}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			RunOnce(context.Background(), src, Pace{}, db, h, nil)
+		}()
+	}
+	wg.Wait()
+
+	sent := tg.sent()
+	for id, n := range sent {
+		if n != 1 {
+			t.Errorf("%s sent %d times", id, n)
+		}
+	}
+	if want := 6 + 4*2; len(sent) != want {
+		t.Errorf("%d pages sent, want %d: %v", len(sent), want, sent)
+	}
+	for w := range shared {
+		if !db.IsSeen(w) {
+			t.Errorf("%s is not seen", w)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+type pendingRow struct {
+	row  ImageRecord
+	done func(error)
+}
+
+// BatchWriter 攒一批 images 行后一次性写入，达到 size 条或等待超过 wait 时触发
+// 每行的结果通过 Add 传入的 done 回调单独通知调用方
+// 攒批中的行不落盘，只有写失败的才进 WriteQueue；进程被强杀时这些行会丢失，见 README 的 DB_BATCH_SIZE
+type BatchWriter struct {
+	store Store
+	size  int
+	wait  time.Duration
+
+	mu      sync.Mutex
+	pending []pendingRow
+	timer   *time.Timer
+	closed  bool
+
+	flushMu sync.Mutex // 同一时间只有一个批次在写
+}
+
+func NewBatchWriter(store Store, size int, wait time.Duration) *BatchWriter {
+	if size <= 0 {
+		size = 1
+	}
+	return &BatchWriter{store: store, size: size, wait: wait}
+}
+
+// Add 加入一行，done 可以为 nil；攒满 size 条时在当前 goroutine 里直接写入
+func (w *BatchWriter) Add(row ImageRecord, done func(error)) {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		w.write([]pendingRow{{row: row, done: done}})
+		return
+	}
+
+	w.pending = append(w.pending, pendingRow{row: row, done: done})
+	if len(w.pending) >= w.size {
+		w.mu.Unlock()
+		w.Flush()
+		return
+	}
+	if w.timer == nil && w.wait > 0 {
+		w.timer = time.AfterFunc(w.wait, w.Flush)
+	}
+	w.mu.Unlock()
+}
+
+// Flush 立即写入所有待写的行，返回后之前 Add 的行都已得到结果
+func (w *BatchWriter) Flush() {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = nil
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.mu.Unlock()
+
+	if len(batch) > 0 {
+		w.write(batch)
+	}
+}
+
+// Close 写完剩余的行，之后的 Add 退化为逐条同步写入
+func (w *BatchWriter) Close() {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+	w.Flush()
+}
+
+func (w *BatchWriter) write(batch []pendingRow) {
+	rows := make([]ImageRecord, len(batch))
+	for i, p := range batch {
+		rows[i] = p.row
+	}
+
+	errs := w.store.SaveImages(rows)
+	failed := 0
+	for i, p := range batch {
+		if errs[i] != nil {
+			failed++
+		}
+		if p.done != nil {
+			p.done(errs[i])
+		}
+	}
+	if len(batch) > 1 {
+		log.Printf("📦 Batch saved %d rows (%d failed)", len(batch)-failed, failed)
+	}
+}
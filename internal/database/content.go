@@ -0,0 +1,50 @@
+package database
+
+import "sync"
+
+// contentIndex 记录本次运行里已上传、可能还在批量写入队列里的图片，按 SHA-256 查找
+// 已经落库的图片走 Store.FindBySHA256，这里只补上还没写进去的那部分
+type contentIndex struct {
+	mu   sync.RWMutex
+	rows map[string]ImageRecord
+}
+
+func newContentIndex() *contentIndex {
+	return &contentIndex{rows: make(map[string]ImageRecord)}
+}
+
+func (x *contentIndex) add(rec ImageRecord) {
+	if rec.SHA256 == "" || rec.FileID == "" {
+		return
+	}
+	x.mu.Lock()
+	if _, ok := x.rows[rec.SHA256]; !ok {
+		x.rows[rec.SHA256] = rec
+	}
+	x.mu.Unlock()
+}
+
+func (x *contentIndex) get(sum string) (ImageRecord, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	rec, ok := x.rows[sum]
+	return rec, ok
+}
+
+func (x *contentIndex) remove(postID string) {
+	x.mu.Lock()
+	for sum, rec := range x.rows {
+		if rec.PostID == postID {
+			delete(x.rows, sum)
+		}
+	}
+	x.mu.Unlock()
+}
+
+// FindByContent 按原图的 SHA-256 查找已上传过的图片，没有时返回 nil
+func (d *DB) FindByContent(sum string) (*ImageRecord, error) {
+	if rec, ok := d.contents.get(sum); ok {
+		return &rec, nil
+	}
+	return d.store.FindBySHA256(sum)
+}
@@ -1,201 +1,160 @@
 package database
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"my-bot-go/internal/config"
-	"strings"
-	"sync"
 	"time"
 
 	"github.com/go-resty/resty/v2"
 )
 
+// D1Client 通过 Cloudflare REST API 读写 D1 数据库
 type D1Client struct {
-	client  *resty.Client
-	cfg     *config.Config
-	History map[string]bool
-	mu       sync.RWMutex
-	lastPush  time.Time
+	client *resty.Client
+	cfg    *config.Config
 }
 
 func NewD1Client(cfg *config.Config) *D1Client {
 	return &D1Client{
-		client:  resty.New(),
-		cfg:     cfg,
-		History: make(map[string]bool),
+		client: resty.New(),
+		cfg:    cfg,
 	}
 }
 
-func (d *D1Client) SyncHistory() {
-	if d.cfg.WorkerURL == "" {
-		return
-	}
-	resp, err := d.client.R().Get(d.cfg.WorkerURL + "/api/get_history")
-	if err != nil {
-		log.Printf("⚠️ Sync history failed: %v", err)
-		return
-	}
-	
-	ids := strings.Split(string(resp.Body()), ",")
-	d.mu.Lock() // <---  加写锁
-	for _, id := range ids {
-		if strings.TrimSpace(id) != "" {
-			d.History[id] = true
-		}
-	}
-	log.Printf("🧠 Synced %d items from history", len(d.History))
-	d.mu.Unlock() // <--- 解写锁
+func (d *D1Client) queryURL() string {
+	return fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/d1/database/%s/query",
+		d.cfg.CF_AccountID, d.cfg.D1_DatabaseID)
 }
 
-func (d *D1Client) PushHistory() {
-	if d.cfg.WorkerURL == "" {
-		return
-	}
-	
-	if time.Since(d.lastPush) < 10*time.Second {
-		return
-	}
+// d1Statement 是 batch 请求里的一条语句
+type d1Statement struct {
+	SQL    string        `json:"sql"`
+	Params []interface{} `json:"params"`
+}
 
-	d.mu.RLock() // <--- 加读锁 (只读不写)
-	var idList []string
-	for id := range d.History {
-		idList = append(idList, id)
-	}
-	d.mu.RUnlock() // <--- 解读锁
-	
-	data := strings.Join(idList, ",")
-	
-	_, err := d.client.R().
-		SetBody(data).
-		Post(d.cfg.WorkerURL + "/api/update_history")
-		
-	if err != nil {
-		log.Printf("⚠️ Push history failed: %v", err)
-	} else {
-		d.lastPush = time.Now()
-		log.Println("☁️ History updated to cloud")
-	}
+// query 执行一条 SQL，返回解析后的结果；失败时返回 AuthError / RateLimitError / SQLError / APIError
+func (d *D1Client) query(sql string, params ...interface{}) ([]D1Result, error) {
+	return d.post(d1Statement{SQL: sql, Params: params})
 }
 
-func (d *D1Client) SaveImage(postID, fileID, originID, caption, artist, tags, source string, width, height int) error {
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/d1/database/%s/query",
-		d.cfg.CF_AccountID, d.cfg.D1_DatabaseID)
-	
-	finalTags := fmt.Sprintf("%s %s", tags, source)
-	
-	sql := "INSERT OR IGNORE INTO images (id, file_name, origin_id, caption, artist, tags, created_at, width, height) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
-	params := []interface{}{postID, fileID, originID, caption, artist, finalTags, time.Now().Unix(), width, height}
-	
-	body := map[string]interface{}{
-		"sql":    sql,
-		"params": params,
-	}
+// batch 在一个请求里执行多条语句，D1 会把它们放进同一个事务，任意一条失败则整批回滚
+func (d *D1Client) batch(stmts []d1Statement) ([]D1Result, error) {
+	return d.post(map[string]interface{}{"batch": stmts})
+}
 
+func (d *D1Client) post(body interface{}) ([]D1Result, error) {
 	resp, err := d.client.R().
 		SetHeader("Authorization", "Bearer "+d.cfg.CF_APIToken).
 		SetHeader("Content-Type", "application/json").
 		SetBody(body).
-		Post(url)
-
+		Post(d.queryURL())
 	if err != nil {
-		return err
-	}
-	if resp.IsError() {
-		return fmt.Errorf("D1 Error: %s", resp.String())
+		return nil, err
 	}
+	return decodeD1Response(resp.StatusCode(), resp.Header(), resp.Body())
+}
 
-	d.mu.Lock() // <--- 加写锁
-	d.History[postID] = true
-	d.mu.Unlock() // <--- 解写锁
-	return nil
+func (d *D1Client) exec(sql string, params ...interface{}) error {
+	_, err := d.query(sql, params...)
+	return err
 }
 
-func (d *D1Client) CheckExists(postID string) bool {
-	// 1. 第一道防线：查内存 (速度快)
-	d.mu.RLock() // <--- 加读锁
-	exists := d.History[postID]
-	d.mu.RUnlock() // <--- 解读锁
-	
-	if exists {
-		return true
+func (d *D1Client) queryRows(sql string, params ...interface{}) ([]map[string]interface{}, error) {
+	results, err := d.query(sql, params...)
+	if err != nil || len(results) == 0 {
+		return nil, err
+	}
+	rows := make([]map[string]interface{}, 0, len(results[0].Results))
+	for _, raw := range results[0].Results {
+		var row map[string]interface{}
+		if err := json.Unmarshal(raw, &row); err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
 	}
+	return rows, nil
+}
+
+func (d *D1Client) SaveImage(rec ImageRecord) error {
+	_, err := d.batch(imageStatements(rec, time.Now().Unix()))
+	return err
+}
 
-	//实时查 D1 数据库
-	// 构造查询 SQL
-	sql := "SELECT 1 FROM images WHERE id = ? LIMIT 1"
-	body := map[string]interface{}{
-		"sql":    sql,
-		"params": []interface{}{postID},
+// imageStatements 返回写入一行需要的语句：images 一条，有别名时再加一条 image_aliases
+func imageStatements(rec ImageRecord, now int64) []d1Statement {
+	stmts := []d1Statement{{SQL: insertImageSQL, Params: rec.insertParams(now)}}
+	if alias := rec.aliasParams(now); alias != nil {
+		stmts = append(stmts, d1Statement{SQL: insertAliasSQL, Params: alias})
 	}
+	return stmts
+}
 
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/d1/database/%s/query",
-		d.cfg.CF_AccountID, d.cfg.D1_DatabaseID)
+func (d *D1Client) SaveImages(rows []ImageRecord) []error {
+	errs := make([]error, len(rows))
+	if len(rows) == 0 {
+		return errs
+	}
 
-	resp, err := d.client.R().
-		SetHeader("Authorization", "Bearer "+d.cfg.CF_APIToken).
-		SetHeader("Content-Type", "application/json").
-		SetBody(body).
-		Post(url)
+	now := time.Now().Unix()
+	var stmts []d1Statement
+	for _, r := range rows {
+		stmts = append(stmts, imageStatements(r, now)...)
+	}
 
-	if err != nil {
-		log.Printf("⚠️ D1 Check Error: %v", err)
-		// return false // “宁可发重，不可漏发”
-		// return true  // “宁可漏发，不可发重”
-		return false 
+	_, err := d.batch(stmts)
+	if err == nil {
+		return errs
 	}
 
-	respStr := resp.String()
-	
-	cleanStr := strings.ReplaceAll(respStr, " ", "")
-	
-	if strings.Contains(cleanStr, "\"results\":[]") {
-		return false
+	var sqlErr *SQLError
+	if len(rows) == 1 || !errors.As(err, &sqlErr) {
+		// 鉴权、限流、网络错误对整批都一样
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
 	}
 
-	if strings.Contains(cleanStr, "\"success\":true") {
-		d.mu.Lock() // <--- 加写锁 
-		d.History[postID] = true
-		d.mu.Unlock() // <--- 解写锁
-		return true
+	// 整批因为某一行回滚了，逐条重试找出是哪一行
+	log.Printf("⚠️ D1 batch failed, retrying %d rows one by one: %v", len(rows), err)
+	for i, r := range rows {
+		errs[i] = d.SaveImage(r)
 	}
+	return errs
+}
 
-	return false
+func (d *D1Client) Exists(postID string) (bool, error) {
+	results, err := d.query(existsSQL, postID, postID)
+	if err != nil {
+		return false, err
+	}
+	return len(results) > 0 && len(results[0].Results) > 0, nil
 }
 
-// DeleteImage 从数据库中删除指定 ID 的图片记录
 func (d *D1Client) DeleteImage(postID string) error {
-    url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/d1/database/%s/query",
-        d.cfg.CF_AccountID, d.cfg.D1_DatabaseID)
-
-    // 构造 DELETE SQL
-    sql := "DELETE FROM images WHERE id = ?"
-    params := []interface{}{postID}
-
-    body := map[string]interface{}{
-        "sql":    sql,
-        "params": params,
-    }
-
-    resp, err := d.client.R().
-        SetHeader("Authorization", "Bearer "+d.cfg.CF_APIToken).
-        SetHeader("Content-Type", "application/json").
-        SetBody(body).
-        Post(url)
-
-    if err != nil {
-        return err
-    }
-
-    if resp.IsError() {
-        return fmt.Errorf("D1 API Error: %s", resp.String())
-    }
-
-	d.mu.Lock() // <--- 加写锁
-    delete(d.History, postID)
-	d.mu.Unlock() // <--- 解写锁
-    
-    // d.PushHistory()     // 可选：立即同步一次历史记录
-
-    return nil
+	// 构造 DELETE SQL，别名跟着图片一起删
+	_, err := d.batch([]d1Statement{
+		{SQL: "DELETE FROM images WHERE id = ?", Params: []interface{}{postID}},
+		{SQL: "DELETE FROM image_aliases WHERE image_id = ?", Params: []interface{}{postID}},
+	})
+	return err
+}
+
+func (d *D1Client) Close() error {
+	return nil
+}
+
+func (d *D1Client) GetImage(postID string) (*ImageRecord, error) {
+	return getImage(d, postID)
+}
+
+func (d *D1Client) ListHashes() (map[string]HashEntry, error) {
+	return listHashes(d)
+}
+
+func (d *D1Client) FindBySHA256(sum string) (*ImageRecord, error) {
+	return findBySHA256(d, sum)
 }
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// D1 /query 接口的返回结构
+// 参考 https://developers.cloudflare.com/api/operations/cloudflare-d1-query-database
+type d1Envelope struct {
+	Success  bool        `json:"success"`
+	Errors   []D1Message `json:"errors"`
+	Messages []D1Message `json:"messages"`
+	Result   []D1Result  `json:"result"`
+}
+
+// D1Message 是 errors / messages 里的一条
+type D1Message struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// D1Result 对应一条 SQL 语句的执行结果
+type D1Result struct {
+	Success bool              `json:"success"`
+	Meta    D1Meta            `json:"meta"`
+	Results []json.RawMessage `json:"results"`
+}
+
+type D1Meta struct {
+	ChangedDB   bool    `json:"changed_db"`
+	Changes     int     `json:"changes"`
+	Duration    float64 `json:"duration"`
+	LastRowID   int64   `json:"last_row_id"`
+	RowsRead    int     `json:"rows_read"`
+	RowsWritten int     `json:"rows_written"`
+}
+
+// AuthError 表示 API Token 无效或没有 D1 权限
+type AuthError struct {
+	Status int
+	Errors []D1Message
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("D1 auth failed (HTTP %d): %s", e.Status, joinD1Messages(e.Errors))
+}
+
+// RateLimitError 表示被 Cloudflare 限流，RetryAfter 为建议的等待时间
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Errors     []D1Message
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("D1 rate limited (retry after %v): %s", e.RetryAfter, joinD1Messages(e.Errors))
+}
+
+// SQLError 表示 SQL 本身执行失败（语法错误、约束冲突等）
+type SQLError struct {
+	Errors []D1Message
+}
+
+func (e *SQLError) Error() string {
+	return "D1 SQL error: " + joinD1Messages(e.Errors)
+}
+
+// APIError 是其它无法归类的失败
+type APIError struct {
+	Status int
+	Errors []D1Message
+	Body   string
+}
+
+func (e *APIError) Error() string {
+	if len(e.Errors) > 0 {
+		return fmt.Sprintf("D1 API error (HTTP %d): %s", e.Status, joinD1Messages(e.Errors))
+	}
+	return fmt.Sprintf("D1 API error (HTTP %d): %s", e.Status, e.Body)
+}
+
+// Cloudflare 的鉴权相关错误码
+const (
+	d1CodeAuthError    = 10000
+	d1CodeInvalidToken = 9109
+	d1CodeRateLimited  = 971
+)
+
+// decodeD1Response 解析 /query 的返回，成功时返回每条语句的结果
+func decodeD1Response(status int, header http.Header, body []byte) ([]D1Result, error) {
+	var env d1Envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		// 网关错误等情况下返回的可能不是 JSON
+		return nil, &APIError{Status: status, Body: truncate(string(body), 200)}
+	}
+
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden || hasD1Code(env.Errors, d1CodeAuthError, d1CodeInvalidToken):
+		return nil, &AuthError{Status: status, Errors: env.Errors}
+	case status == http.StatusTooManyRequests || hasD1Code(env.Errors, d1CodeRateLimited):
+		return nil, &RateLimitError{RetryAfter: parseRetryAfter(header), Errors: env.Errors}
+	case !env.Success:
+		if status == http.StatusBadRequest || status == http.StatusOK {
+			return nil, &SQLError{Errors: env.Errors}
+		}
+		return nil, &APIError{Status: status, Errors: env.Errors}
+	}
+
+	for _, r := range env.Result {
+		if !r.Success {
+			return nil, &SQLError{Errors: env.Errors}
+		}
+	}
+	return env.Result, nil
+}
+
+func hasD1Code(msgs []D1Message, codes ...int) bool {
+	for _, m := range msgs {
+		for _, c := range codes {
+			if m.Code == c {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func joinD1Messages(msgs []D1Message) string {
+	if len(msgs) == 0 {
+		return "no details"
+	}
+	parts := make([]string, len(msgs))
+	for i, m := range msgs {
+		parts[i] = fmt.Sprintf("[%d] %s", m.Code, m.Message)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func parseRetryAfter(header http.Header) time.Duration {
+	if secs, err := strconv.Atoi(header.Get("Retry-After")); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return 10 * time.Second
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
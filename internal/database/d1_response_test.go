@@ -0,0 +1,75 @@
+package database
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeD1ResponseSuccess(t *testing.T) {
+	body := `{"success":true,"errors":[],"messages":[],"result":[
+		{"success":true,"meta":{"changes":1,"last_row_id":7},"results":[{"post_id":"a"}]},
+		{"success":true,"meta":{"changes":0},"results":[]}
+	]}`
+	results, err := decodeD1Response(http.StatusOK, http.Header{}, []byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Meta.LastRowID != 7 || len(results[0].Results) != 1 {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+}
+
+func TestDecodeD1ResponseErrors(t *testing.T) {
+	retry := http.Header{}
+	retry.Set("Retry-After", "30")
+
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		body   string
+		check  func(error) bool
+	}{
+		{"unauthorized", 401, nil, `{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`,
+			func(err error) bool { var e *AuthError; return errors.As(err, &e) && e.Status == 401 }},
+		{"invalid token code", 400, nil, `{"success":false,"errors":[{"code":9109,"message":"Invalid access token"}]}`,
+			func(err error) bool { var e *AuthError; return errors.As(err, &e) }},
+		{"rate limited", 429, retry, `{"success":false,"errors":[{"code":971,"message":"Please wait"}]}`,
+			func(err error) bool {
+				var e *RateLimitError
+				return errors.As(err, &e) && e.RetryAfter == 30*time.Second
+			}},
+		{"rate limited default wait", 200, nil, `{"success":false,"errors":[{"code":971,"message":"Please wait"}]}`,
+			func(err error) bool {
+				var e *RateLimitError
+				return errors.As(err, &e) && e.RetryAfter == 10*time.Second
+			}},
+		{"sql error", 400, nil, `{"success":false,"errors":[{"code":7500,"message":"near \"SELEC\": syntax error"}]}`,
+			func(err error) bool {
+				var e *SQLError
+				return errors.As(err, &e) && strings.Contains(err.Error(), "syntax error")
+			}},
+		{"statement failed", 200, nil, `{"success":true,"errors":[],"result":[{"success":false}]}`,
+			func(err error) bool { var e *SQLError; return errors.As(err, &e) }},
+		{"server error", 500, nil, `{"success":false,"errors":[{"code":7000,"message":"internal"}]}`,
+			func(err error) bool { var e *APIError; return errors.As(err, &e) && e.Status == 500 }},
+		{"not json", 502, nil, `<html>Bad gateway</html>`,
+			func(err error) bool {
+				var e *APIError
+				return errors.As(err, &e) && e.Body == "<html>Bad gateway</html>"
+			}},
+	}
+	for _, tt := range tests {
+		header := tt.header
+		if header == nil {
+			header = http.Header{}
+		}
+		_, err := decodeD1Response(tt.status, header, []byte(tt.body))
+		if err == nil || !tt.check(err) {
+			t.Errorf("%s: got %T %v", tt.name, err, err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package database
+
+import (
+	"context"
+	"log"
+	"my-bot-go/internal/config"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// DB 是 Bot 使用的数据库入口：内存历史 + Worker 同步 + 可替换的 Store 后端
+type DB struct {
+	store    Store
+	batch    *BatchWriter
+	queue    *WriteQueue
+	hashes   *hashIndex
+	contents *contentIndex
+	client   *resty.Client
+	cfg      *config.Config
+	history  map[string]bool
+	mu       sync.RWMutex
+	lastPush time.Time
+
+	// 增量同步状态，见 history.go
+	pushMu         sync.Mutex
+	pushed         map[string]bool // 已同步到云端的 ID
+	removed        map[string]bool // 删除后还没同步到云端的 ID
+	historyVersion int64
+	legacyHistory  bool
+}
+
+// New 按 STORE_BACKEND 打开对应的存储后端
+func New(cfg *config.Config) (*DB, error) {
+	store, err := OpenStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newDB(cfg, store), nil
+}
+
+func newDB(cfg *config.Config, store Store) *DB {
+	d := &DB{
+		store:    store,
+		batch:    NewBatchWriter(store, cfg.BatchSize, cfg.BatchWait),
+		client:   resty.New(),
+		cfg:      cfg,
+		history:  make(map[string]bool),
+		pushed:   make(map[string]bool),
+		removed:  make(map[string]bool),
+		hashes:   newHashIndex(),
+		contents: newContentIndex(),
+	}
+	if cfg.PHashDistance > 0 {
+		d.hashes.load(store)
+	}
+	d.queue = NewWriteQueue(cfg.WriteQueuePath, store, d.markSaved)
+	return d
+}
+
+// RunQueue 在后台重试写库失败的行，直到 ctx 结束
+func (d *DB) RunQueue(ctx context.Context) {
+	go d.queue.Run(ctx)
+}
+
+// Queue 返回写库失败待重试的队列
+func (d *DB) Queue() *WriteQueue {
+	return d.queue
+}
+
+func (d *DB) Close() error {
+	d.batch.Close()
+	return d.store.Close()
+}
+
+// Flush 把批量写入队列里的行立即写入存储
+func (d *DB) Flush() {
+	d.batch.Flush()
+}
+
+// SaveImage 同步写入一行，失败时放进本地重试队列并返回错误
+func (d *DB) SaveImage(rec ImageRecord) error {
+	d.indexRecord(rec)
+	if err := d.store.SaveImage(rec); err != nil {
+		// 图已经发到频道了，file_id 不能丢，放进本地队列稍后重试
+		d.queue.Push(rec, err)
+		return err
+	}
+
+	d.markSaved(rec)
+	return nil
+}
+
+// QueueImage 与 SaveImage 相同，但先放进批量写入队列，写入结果通过 done 回调通知（可以为 nil）
+func (d *DB) QueueImage(rec ImageRecord, done func(error)) {
+	// 写库之前就进索引，同一批里的相似图也能互相发现
+	d.indexRecord(rec)
+	d.batch.Add(rec, func(err error) {
+		if err != nil {
+			d.queue.Push(rec, err)
+		} else {
+			d.markSaved(rec)
+		}
+		if done != nil {
+			done(err)
+		}
+	})
+}
+
+// markSaved 在写库成功后把 ID 和原站 ID 一起记入历史，其它来源再遇到这张图时直接跳过
+func (d *DB) markSaved(rec ImageRecord) {
+	if rec.CanonicalID != "" {
+		d.MarkSeen(rec.PostID, rec.CanonicalID)
+		return
+	}
+	d.MarkSeen(rec.PostID)
+}
+
+// indexRecord 把感知哈希和内容哈希放进内存索引
+func (d *DB) indexRecord(rec ImageRecord) {
+	if rec.PHash != "" {
+		d.hashes.add(rec.PostID, rec.PHash, rec.ArtworkKey())
+	}
+	d.contents.add(rec)
+}
+
+// MarkSeen 把 ID 记入内存历史，下次 PushHistory 时同步到云端
+func (d *DB) MarkSeen(ids ...string) {
+	d.mu.Lock()
+	for _, id := range ids {
+		d.history[id] = true
+	}
+	d.mu.Unlock()
+}
+
+// IsSeen 只查内存历史，不访问存储后端
+func (d *DB) IsSeen(id string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.history[id]
+}
+
+// Forget 从内存历史中移除 ID，下次 PushHistory 时同步删除
+func (d *DB) Forget(id string) {
+	d.mu.Lock()
+	delete(d.history, id)
+	d.removed[id] = true
+	d.mu.Unlock()
+}
+
+// HistorySize 返回内存历史里的 ID 数量
+func (d *DB) HistorySize() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.history)
+}
+
+// CheckExists 查 ID 是否已发过，也包括以别的来源 ID 存进库、但原站 ID 就是 postID 的图
+func (d *DB) CheckExists(postID string) bool {
+	// 1. 第一道防线：查内存 (速度快)
+	if d.IsSeen(postID) {
+		return true
+	}
+
+	// 2. 实时查存储后端
+	exists, err := d.store.Exists(postID)
+	if err != nil {
+		log.Printf("⚠️ DB Check Error: %v", err)
+		// return false // “宁可发重，不可漏发”
+		// return true  // “宁可漏发，不可发重”
+		return false
+	}
+
+	if exists {
+		d.MarkSeen(postID)
+	}
+	return exists
+}
+
+// DeleteImage 从数据库中删除指定 ID 的图片记录
+func (d *DB) DeleteImage(postID string) error {
+	if err := d.store.DeleteImage(postID); err != nil {
+		return err
+	}
+
+	d.Forget(postID)
+	d.hashes.remove(postID)
+	d.contents.remove(postID)
+
+	// d.PushHistory()     // 可选：立即同步一次历史记录
+
+	return nil
+}
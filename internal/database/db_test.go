@@ -0,0 +1,101 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"my-bot-go/internal/config"
+)
+
+// 模拟几个爬虫同时跑：各自查重、记历史、写库、删除，go test -race 下不能有数据竞争
+func TestConcurrentCrawlers(t *testing.T) {
+	d, store := newTestDB(t, &config.Config{BatchSize: 5, BatchWait: time.Millisecond})
+
+	const crawlers = 8
+	const perCrawler = 200
+
+	var wg sync.WaitGroup
+	for c := 0; c < crawlers; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for i := 0; i < perCrawler; i++ {
+				id := fmt.Sprintf("src%d_%d", c, i)
+				if d.CheckExists(id) {
+					t.Errorf("%s seen before it was saved", id)
+				}
+				d.QueueImage(ImageRecord{PostID: id}, nil)
+				d.MarkSeen(id, "alias_"+id)
+				d.IsSeen(fmt.Sprintf("src%d_%d", (c+1)%crawlers, i))
+				if i%10 == 0 {
+					d.Forget("alias_" + id)
+				}
+				if i%25 == 0 {
+					d.Flush()
+				}
+				d.HistorySize()
+			}
+		}(c)
+	}
+	wg.Wait()
+	d.Flush()
+
+	for c := 0; c < crawlers; c++ {
+		for i := 0; i < perCrawler; i++ {
+			id := fmt.Sprintf("src%d_%d", c, i)
+			if !d.IsSeen(id) {
+				t.Fatalf("%s missing from history", id)
+			}
+			if ok, _ := store.Exists(id); !ok {
+				t.Fatalf("%s missing from store", id)
+			}
+			if d.IsSeen("alias_"+id) == (i%10 == 0) {
+				t.Fatalf("alias_%s: Forget not applied correctly", id)
+			}
+		}
+	}
+	if want := crawlers*perCrawler*2 - crawlers*perCrawler/10; d.HistorySize() != want {
+		t.Fatalf("history size = %d, want %d", d.HistorySize(), want)
+	}
+}
+
+// 写库失败的行进入重试队列，存储恢复后 Flush 补写，并记入历史
+func TestConcurrentQueueRetry(t *testing.T) {
+	d, store := newTestDB(t, &config.Config{BatchSize: 3})
+	store.fail = errors.New("D1 unavailable")
+
+	var wg sync.WaitGroup
+	for c := 0; c < 4; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for i := 0; i < 30; i++ {
+				d.SaveImage(ImageRecord{PostID: fmt.Sprintf("q%d_%d", c, i)})
+				d.Flush()
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	if n := d.Queue().Len(); n != 120 {
+		t.Fatalf("queue length = %d, want 120", n)
+	}
+	if d.IsSeen("q0_0") {
+		t.Fatal("failed row marked as seen")
+	}
+
+	store.mu.Lock()
+	store.fail = nil
+	store.mu.Unlock()
+
+	saved, left := d.Queue().Flush()
+	if saved != 120 || left != 0 {
+		t.Fatalf("queue flush saved %d, left %d", saved, left)
+	}
+	if !d.IsSeen("q3_29") {
+		t.Fatal("retried row not marked as seen")
+	}
+}
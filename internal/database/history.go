@@ -0,0 +1,335 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 历史记录增量同步协议 (见 web-worker/src/logic.js)：
+//   GET  /api/history/changes?since=<version>  -> {"version":N,"add":[...],"remove":[...],"more":bool}
+//        同一页里同一个 ID 只按最后一次操作出现在 add 或 remove 里
+//   POST /api/history/append {"add":[...],"remove":[...]} -> {"from":N,"to":M} (这次写入的版本范围)
+// 版本号只由 pullChanges 推进，append 之后不能直接跳到最新版本，否则会漏掉其它写入方插在中间的变化
+// Worker 没有这两个接口时 (404) 退回旧的 /api/get_history 与 /api/update_history 全量同步
+
+type historyChanges struct {
+	Version int64    `json:"version"`
+	Add     []string `json:"add"`
+	Remove  []string `json:"remove"`
+	More    bool     `json:"more"`
+}
+
+type historyAppend struct {
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+// historyCache 是本地缓存的历史记录，启动时只需要拉取 Version 之后的变化
+type historyCache struct {
+	Version int64    `json:"version"`
+	IDs     []string `json:"ids"`
+}
+
+func (d *DB) SyncHistory() {
+	if d.cfg.WorkerURL == "" {
+		return
+	}
+
+	d.pushMu.Lock()
+	defer d.pushMu.Unlock()
+
+	d.loadHistoryCache()
+	fresh := d.historyVersion == 0
+
+	if err := d.pullChanges(); err != nil {
+		if err != errLegacyHistory {
+			log.Printf("⚠️ Sync history failed: %v", err)
+			return
+		}
+		log.Println("⚠️ Worker has no incremental history API, falling back to full sync")
+		d.legacyHistory = true
+		if err := d.pullFullHistory(); err != nil {
+			log.Printf("⚠️ Sync history failed: %v", err)
+			return
+		}
+	} else if fresh && d.historyVersion == 0 {
+		// 增量日志还是空的：第一次用新 Worker，把旧的全量历史搬进日志，否则旧作品都会被当成没发过
+		if err := d.seedHistoryLog(); err != nil {
+			log.Printf("⚠️ Seed history log failed: %v", err)
+			return
+		}
+	}
+
+	// 此时内存里的都是云端已有的
+	d.mu.Lock()
+	for id := range d.history {
+		d.pushed[id] = true
+	}
+	log.Printf("🧠 Synced %d items from history (version %d)", len(d.history), d.historyVersion)
+	d.mu.Unlock()
+
+	d.saveHistoryCache()
+}
+
+// PushHistory 上传上次以来新增/删除的 ID，全量模式下 10 秒内最多上传一次
+func (d *DB) PushHistory() {
+	d.pushHistory(false)
+}
+
+// PushHistoryNow 与 PushHistory 相同但不受节流限制，用于关机和 /save
+func (d *DB) PushHistoryNow() {
+	d.pushHistory(true)
+}
+
+func (d *DB) pushHistory(force bool) {
+	if d.cfg.WorkerURL == "" {
+		return
+	}
+
+	d.pushMu.Lock()
+	defer d.pushMu.Unlock()
+
+	d.mu.RLock()
+	var add, remove []string
+	for id := range d.history {
+		if !d.pushed[id] {
+			add = append(add, id)
+		}
+	}
+	for id := range d.removed {
+		remove = append(remove, id)
+	}
+	d.mu.RUnlock()
+
+	if len(add) == 0 && len(remove) == 0 {
+		return
+	}
+
+	if !d.legacyHistory {
+		err := d.appendChanges(add, remove)
+		if err == errLegacyHistory {
+			log.Println("⚠️ Worker has no incremental history API, falling back to full sync")
+			d.legacyHistory = true
+		} else if err != nil {
+			log.Printf("⚠️ Push history failed: %v", err)
+			return
+		}
+	}
+
+	if d.legacyHistory {
+		if !force && time.Since(d.lastPush) < 10*time.Second {
+			return
+		}
+		if err := d.pushFullHistory(); err != nil {
+			log.Printf("⚠️ Push history failed: %v", err)
+			return
+		}
+		d.lastPush = time.Now()
+	}
+
+	d.mu.Lock()
+	for _, id := range add {
+		d.pushed[id] = true
+	}
+	for _, id := range remove {
+		delete(d.removed, id)
+		delete(d.pushed, id)
+	}
+	d.mu.Unlock()
+
+	d.saveHistoryCache()
+	log.Printf("☁️ History updated to cloud (+%d/-%d)", len(add), len(remove))
+}
+
+var errLegacyHistory = errors.New("incremental history API not available")
+
+func (d *DB) pullChanges() error {
+	for {
+		resp, err := d.client.R().
+			SetQueryParam("since", strconv.FormatInt(d.historyVersion, 10)).
+			Get(d.cfg.WorkerURL + "/api/history/changes")
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode() == http.StatusNotFound {
+			return errLegacyHistory
+		}
+		if resp.IsError() {
+			return fmt.Errorf("HTTP %d: %s", resp.StatusCode(), truncate(resp.String(), 200))
+		}
+
+		var changes historyChanges
+		if err := json.Unmarshal(resp.Body(), &changes); err != nil {
+			return err
+		}
+
+		d.mu.Lock()
+		for _, id := range changes.Add {
+			d.history[id] = true
+		}
+		for _, id := range changes.Remove {
+			delete(d.history, id)
+		}
+		d.mu.Unlock()
+
+		d.historyVersion = changes.Version
+		if !changes.More {
+			return nil
+		}
+	}
+}
+
+func (d *DB) appendChanges(add, remove []string) error {
+	resp, err := d.client.R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(historyAppend{Add: add, Remove: remove}).
+		Post(d.cfg.WorkerURL + "/api/history/append")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() == http.StatusNotFound {
+		return errLegacyHistory
+	}
+	if resp.IsError() {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode(), truncate(resp.String(), 200))
+	}
+
+	var result struct {
+		From int64 `json:"from"`
+		To   int64 `json:"to"`
+	}
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return err
+	}
+	log.Printf("☁️ History log appended (versions %d-%d)", result.From, result.To)
+	return nil
+}
+
+// seedHistoryLog 把旧接口的全量历史和本地已有的 ID 一次性写进空的增量日志
+func (d *DB) seedHistoryLog() error {
+	if err := d.pullFullHistory(); err != nil && err != errLegacyHistory {
+		return err
+	}
+
+	d.mu.RLock()
+	ids := make([]string, 0, len(d.history))
+	for id := range d.history {
+		ids = append(ids, id)
+	}
+	d.mu.RUnlock()
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if err := d.appendChanges(ids, nil); err != nil {
+		return err
+	}
+	log.Printf("🧱 Seeded history log with %d items", len(ids))
+	return nil
+}
+
+func (d *DB) pullFullHistory() error {
+	resp, err := d.client.R().Get(d.cfg.WorkerURL + "/api/get_history")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() == http.StatusNotFound {
+		return errLegacyHistory
+	}
+	if resp.IsError() {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode(), truncate(resp.String(), 200))
+	}
+
+	ids := strings.Split(string(resp.Body()), ",")
+	d.mu.Lock() // <---  加写锁
+	for _, id := range ids {
+		if strings.TrimSpace(id) != "" {
+			d.history[id] = true
+		}
+	}
+	d.mu.Unlock() // <--- 解写锁
+	return nil
+}
+
+func (d *DB) pushFullHistory() error {
+	d.mu.RLock() // <--- 加读锁 (只读不写)
+	var idList []string
+	for id := range d.history {
+		idList = append(idList, id)
+	}
+	d.mu.RUnlock() // <--- 解读锁
+
+	_, err := d.client.R().
+		SetBody(strings.Join(idList, ",")).
+		Post(d.cfg.WorkerURL + "/api/update_history")
+	return err
+}
+
+func (d *DB) loadHistoryCache() {
+	if d.cfg.HistoryCachePath == "" {
+		return
+	}
+	data, err := os.ReadFile(d.cfg.HistoryCachePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("⚠️ Read history cache failed: %v", err)
+		}
+		return
+	}
+
+	var cache historyCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		log.Printf("⚠️ History cache is corrupted, doing a full sync: %v", err)
+		return
+	}
+
+	d.mu.Lock()
+	for _, id := range cache.IDs {
+		d.history[id] = true
+	}
+	d.mu.Unlock()
+	d.historyVersion = cache.Version
+	log.Printf("📂 Loaded %d items from history cache (version %d)", len(cache.IDs), cache.Version)
+}
+
+// saveHistoryCache 只缓存已经同步到云端的 ID，先写临时文件再改名，避免写一半被打断
+func (d *DB) saveHistoryCache() {
+	if d.cfg.HistoryCachePath == "" {
+		return
+	}
+
+	d.mu.RLock()
+	cache := historyCache{Version: d.historyVersion, IDs: make([]string, 0, len(d.pushed))}
+	for id := range d.pushed {
+		cache.IDs = append(cache.IDs, id)
+	}
+	d.mu.RUnlock()
+
+	data, err := json.Marshal(cache)
+	if err != nil {
+		log.Printf("⚠️ Save history cache failed: %v", err)
+		return
+	}
+
+	path := d.cfg.HistoryCachePath
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		log.Printf("⚠️ Save history cache failed: %v", err)
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		log.Printf("⚠️ Save history cache failed: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		log.Printf("⚠️ Save history cache failed: %v", err)
+	}
+}
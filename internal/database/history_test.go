@@ -0,0 +1,186 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"my-bot-go/internal/config"
+)
+
+// fakeWorker 模拟 Worker 的历史记录接口，log 是 history_log 表
+type fakeWorker struct {
+	mu     sync.Mutex
+	log    []historyRow
+	legacy string // /api/get_history 的内容，为空时返回 404
+}
+
+type historyRow struct {
+	id string
+	op string
+}
+
+func (w *fakeWorker) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/api/history/changes":
+		var since int
+		fmt.Sscan(r.URL.Query().Get("since"), &since)
+		last := make(map[string]string)
+		var order []string
+		for v := since; v < len(w.log); v++ {
+			row := w.log[v]
+			if _, ok := last[row.id]; !ok {
+				order = append(order, row.id)
+			}
+			last[row.id] = row.op
+		}
+		changes := historyChanges{Version: int64(len(w.log)), Add: []string{}, Remove: []string{}}
+		for _, id := range order {
+			if last[id] == "remove" {
+				changes.Remove = append(changes.Remove, id)
+			} else {
+				changes.Add = append(changes.Add, id)
+			}
+		}
+		json.NewEncoder(rw).Encode(changes)
+	case "/api/history/append":
+		var body historyAppend
+		json.NewDecoder(r.Body).Decode(&body)
+		from := len(w.log) + 1
+		for _, id := range body.Add {
+			w.log = append(w.log, historyRow{id, "add"})
+		}
+		for _, id := range body.Remove {
+			w.log = append(w.log, historyRow{id, "remove"})
+		}
+		fmt.Fprintf(rw, `{"from":%d,"to":%d}`, from, len(w.log))
+	case "/api/get_history":
+		if w.legacy == "" {
+			http.NotFound(rw, r)
+			return
+		}
+		fmt.Fprint(rw, w.legacy)
+	default:
+		http.NotFound(rw, r)
+	}
+}
+
+// add 模拟另一个写入方直接往日志里追加
+func (w *fakeWorker) add(id, op string) {
+	w.mu.Lock()
+	w.log = append(w.log, historyRow{id, op})
+	w.mu.Unlock()
+}
+
+func (w *fakeWorker) ids() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var ids []string
+	for _, row := range w.log {
+		ids = append(ids, row.op+":"+row.id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func newWorkerDB(t *testing.T, w *fakeWorker) *DB {
+	t.Helper()
+	srv := httptest.NewServer(w)
+	t.Cleanup(srv.Close)
+	d, _ := newTestDB(t, &config.Config{WorkerURL: srv.URL})
+	return d
+}
+
+func TestSyncHistorySeedsEmptyLog(t *testing.T) {
+	w := &fakeWorker{legacy: "pixiv_1_p0,yande_2"}
+	d := newWorkerDB(t, w)
+
+	d.SyncHistory()
+
+	want := []string{"add:pixiv_1_p0", "add:yande_2"}
+	if got := w.ids(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("history_log = %v, want %v", got, want)
+	}
+	if !d.IsSeen("pixiv_1_p0") || !d.IsSeen("yande_2") {
+		t.Fatal("legacy history not loaded")
+	}
+
+	// 日志已经有内容，第二次同步不再重复写入
+	d2 := newWorkerDB(t, w)
+	d2.SyncHistory()
+	if got := w.ids(); len(got) != 2 {
+		t.Fatalf("history_log seeded twice: %v", got)
+	}
+	if !d2.IsSeen("yande_2") {
+		t.Fatal("seeded history not pulled")
+	}
+}
+
+func TestSyncHistoryWithoutLegacyAPI(t *testing.T) {
+	w := &fakeWorker{}
+	d := newWorkerDB(t, w)
+
+	d.SyncHistory()
+
+	if got := w.ids(); len(got) != 0 {
+		t.Fatalf("history_log = %v, want empty", got)
+	}
+	if d.HistorySize() != 0 {
+		t.Fatalf("404 page loaded as history: %d items", d.HistorySize())
+	}
+}
+
+func TestAppendKeepsVersionCursor(t *testing.T) {
+	w := &fakeWorker{}
+	w.add("a", "add")
+	d := newWorkerDB(t, w)
+	d.SyncHistory()
+	if d.historyVersion != 1 {
+		t.Fatalf("version = %d, want 1", d.historyVersion)
+	}
+
+	// 另一个写入方在这次 append 之前写了一行
+	w.add("other", "add")
+	d.MarkSeen("mine")
+	d.PushHistoryNow()
+
+	if d.historyVersion != 1 {
+		t.Fatalf("append moved version to %d", d.historyVersion)
+	}
+	if err := d.pullChanges(); err != nil {
+		t.Fatal(err)
+	}
+	if !d.IsSeen("other") {
+		t.Fatal("change from another writer was skipped")
+	}
+	if d.historyVersion != 3 {
+		t.Fatalf("version = %d, want 3", d.historyVersion)
+	}
+}
+
+func TestPullChangesRemoveThenAdd(t *testing.T) {
+	w := &fakeWorker{}
+	w.add("a", "add")
+	w.add("a", "remove")
+	w.add("a", "add")
+	w.add("b", "add")
+	w.add("b", "remove")
+	d := newWorkerDB(t, w)
+
+	if err := d.pullChanges(); err != nil {
+		t.Fatal(err)
+	}
+	if !d.IsSeen("a") {
+		t.Fatal("a was re-added last but is missing")
+	}
+	if d.IsSeen("b") {
+		t.Fatal("b was removed last but is present")
+	}
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// sqlRunner 是 D1 和 SQLite 都能提供的最基本的 SQL 能力，用于建表和迁移
+type sqlRunner interface {
+	exec(sql string, params ...interface{}) error
+	queryRows(sql string, params ...interface{}) ([]map[string]interface{}, error)
+}
+
+// migration 是一次表结构变更，Version 从 1 开始连续递增，已发布的迁移不要修改
+type migration struct {
+	Version int
+	Name    string
+	Up      func(r sqlRunner) error
+}
+
+// migrations 按版本顺序排列，新的迁移追加在末尾
+var migrations = []migration{
+	{1, "create images", func(r sqlRunner) error {
+		return r.exec(`CREATE TABLE IF NOT EXISTS images (
+  id TEXT PRIMARY KEY,
+  file_name TEXT,
+  origin_id TEXT,
+  caption TEXT,
+  tags TEXT,
+  created_at INTEGER,
+  width INTEGER,
+  height INTEGER
+)`)
+	}},
+	// README 里最早的建表语句没有 artist，但 SaveImage 一直在写它
+	{2, "add images.artist", func(r sqlRunner) error {
+		return addColumn(r, "images", "artist", "TEXT")
+	}},
+	{3, "add images metadata columns", func(r sqlRunner) error {
+		for _, col := range [][2]string{
+			{"platform", "TEXT"},
+			{"source_url", "TEXT"},
+			{"artwork_id", "TEXT"},
+			{"page_index", "INTEGER DEFAULT 0"},
+			{"r18", "INTEGER DEFAULT 0"},
+			{"file_size", "INTEGER DEFAULT 0"},
+			{"mime_type", "TEXT"},
+		} {
+			if err := addColumn(r, "images", col[0], col[1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{4, "add images.phash", func(r sqlRunner) error {
+		return addColumn(r, "images", "phash", "TEXT")
+	}},
+	// 同一张图在原站的 ID (canonical_id) -> 实际存进 images 的 ID
+	{5, "create image_aliases", func(r sqlRunner) error {
+		err := r.exec(`CREATE TABLE IF NOT EXISTS image_aliases (
+  canonical_id TEXT NOT NULL,
+  image_id TEXT NOT NULL,
+  created_at INTEGER,
+  PRIMARY KEY (canonical_id, image_id)
+)`)
+		if err != nil {
+			return err
+		}
+		return r.exec("CREATE INDEX IF NOT EXISTS idx_image_aliases_image_id ON image_aliases (image_id)")
+	}},
+	{6, "add images.sha256", func(r sqlRunner) error {
+		if err := addColumn(r, "images", "sha256", "TEXT"); err != nil {
+			return err
+		}
+		return r.exec("CREATE INDEX IF NOT EXISTS idx_images_sha256 ON images (sha256)")
+	}},
+	// 每个上传后端的位置，JSON 数组，见 storage.Location
+	{7, "add images.storage", func(r sqlRunner) error {
+		return addColumn(r, "images", "storage", "TEXT")
+	}},
+	// 原图超过 Telegram 50MB 限制时的处理方式
+	{8, "add images.original_mode", func(r sqlRunner) error {
+		return addColumn(r, "images", "original_mode", "TEXT")
+	}},
+}
+
+// SchemaVersion 是当前程序认识的最新表结构版本
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// migrate 执行所有未应用的迁移；远端版本比程序新时拒绝启动，避免旧程序写坏新表
+func migrate(r sqlRunner) error {
+	err := r.exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+  version INTEGER PRIMARY KEY,
+  name TEXT,
+  applied_at INTEGER
+)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	current, err := currentVersion(r)
+	if err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if current > SchemaVersion() {
+		return fmt.Errorf("database schema is v%d but this binary only knows up to v%d, please upgrade the bot", current, SchemaVersion())
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if err := m.Up(r); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		if err := r.exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+			m.Version, m.Name, time.Now().Unix()); err != nil {
+			return fmt.Errorf("record migration %d: %w", m.Version, err)
+		}
+		log.Printf("🧱 Applied migration %d: %s", m.Version, m.Name)
+	}
+	return nil
+}
+
+func currentVersion(r sqlRunner) (int, error) {
+	rows, err := r.queryRows("SELECT MAX(version) AS version FROM schema_migrations")
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	return toInt(rows[0]["version"]), nil
+}
+
+// addColumn 在列不存在时才 ALTER TABLE，兼容手动改过表的老库
+func addColumn(r sqlRunner, table, name, def string) error {
+	rows, err := r.queryRows(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if row["name"] == name {
+			return nil
+		}
+	}
+	return r.exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, name, def))
+}
+
+// toInt 兼容 D1 (JSON float64) 和 SQLite (int64) 返回的数字
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	case int:
+		return n
+	default:
+		return 0
+	}
+}
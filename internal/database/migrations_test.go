@@ -0,0 +1,124 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+// memoryStore 返回还没执行迁移的内存 SQLite；单连接保证一直是同一个库
+func memoryStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return &SQLiteStore{db: db}
+}
+
+func columns(t *testing.T, r sqlRunner, table string) map[string]bool {
+	t.Helper()
+	rows, err := r.queryRows("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cols := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		cols[row["name"].(string)] = true
+	}
+	return cols
+}
+
+func migrationCount(t *testing.T, r sqlRunner) int {
+	t.Helper()
+	rows, err := r.queryRows("SELECT COUNT(*) AS n FROM schema_migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return toInt(rows[0]["n"])
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	s := memoryStore(t)
+	if err := migrate(s); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := currentVersion(s); err != nil || v != SchemaVersion() {
+		t.Fatalf("version = %d, %v; want %d", v, err, SchemaVersion())
+	}
+	if SchemaVersion() != 8 {
+		t.Fatalf("SchemaVersion() = %d, update this test with the new migration", SchemaVersion())
+	}
+	cols := columns(t, s, "images")
+	for _, name := range []string{"id", "artist", "platform", "page_index", "phash", "sha256", "storage", "original_mode"} {
+		if !cols[name] {
+			t.Errorf("images.%s missing after migrate", name)
+		}
+	}
+	if !columns(t, s, "image_aliases")["canonical_id"] {
+		t.Error("image_aliases not created")
+	}
+
+	// 再跑一次什么都不做
+	if err := migrate(s); err != nil {
+		t.Fatal(err)
+	}
+	if n := migrationCount(t, s); n != len(migrations) {
+		t.Fatalf("schema_migrations has %d rows after second run, want %d", n, len(migrations))
+	}
+}
+
+// 没有 schema_migrations 但已经手动加过部分列的老库
+func TestMigrateLegacyDatabase(t *testing.T) {
+	s := memoryStore(t)
+	legacy := []string{
+		`CREATE TABLE images (id TEXT PRIMARY KEY, file_name TEXT, origin_id TEXT, caption TEXT, tags TEXT,
+  created_at INTEGER, width INTEGER, height INTEGER, artist TEXT, platform TEXT, phash TEXT)`,
+		`INSERT INTO images (id, file_name, artist, platform) VALUES ('pixiv_1_p0', 'f1', 'someone', 'pixiv')`,
+	}
+	for _, q := range legacy {
+		if err := s.exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := migrate(s); err != nil {
+		t.Fatal(err)
+	}
+	cols := columns(t, s, "images")
+	for _, name := range []string{"source_url", "r18", "sha256", "original_mode"} {
+		if !cols[name] {
+			t.Errorf("images.%s missing after migrate", name)
+		}
+	}
+
+	rec, err := s.GetImage("pixiv_1_p0")
+	if err != nil || rec == nil {
+		t.Fatalf("legacy row lost: %v", err)
+	}
+	if rec.Artist != "someone" || rec.Platform != "pixiv" {
+		t.Fatalf("legacy row = %+v", rec)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	s := memoryStore(t)
+	if err := migrate(s); err != nil {
+		t.Fatal(err)
+	}
+	newer := SchemaVersion() + 1
+	if err := s.exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'from the future', 0)", newer); err != nil {
+		t.Fatal(err)
+	}
+
+	err := migrate(s)
+	if err == nil || !strings.Contains(err.Error(), "please upgrade the bot") {
+		t.Fatalf("migrate on newer schema = %v", err)
+	}
+	if n := migrationCount(t, s); n != len(migrations)+1 {
+		t.Fatalf("schema_migrations changed to %d rows", n)
+	}
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"log"
+	"sync"
+
+	"my-bot-go/internal/imagehash"
+)
+
+// HashEntry 是感知哈希索引里的一项
+type HashEntry struct {
+	PHash   string
+	Artwork string // ImageRecord.ArtworkKey，同一作品的各页不互相比较
+}
+
+type hashItem struct {
+	hash    uint64
+	artwork string
+}
+
+// hashIndex 是内存里的感知哈希索引，汉明距离没法走 SQL 索引，只能线性扫描
+// 64 位哈希逐个异或比较，十万张图也只要几毫秒
+type hashIndex struct {
+	mu     sync.RWMutex
+	hashes map[string]hashItem
+}
+
+func newHashIndex() *hashIndex {
+	return &hashIndex{hashes: make(map[string]hashItem)}
+}
+
+func (x *hashIndex) load(store Store) {
+	list, err := store.ListHashes()
+	if err != nil {
+		log.Printf("⚠️ Load perceptual hashes failed: %v", err)
+		return
+	}
+
+	x.mu.Lock()
+	for id, e := range list {
+		if h, err := imagehash.Parse(e.PHash); err == nil {
+			x.hashes[id] = hashItem{hash: h, artwork: e.Artwork}
+		}
+	}
+	x.mu.Unlock()
+	log.Printf("🧬 Loaded %d perceptual hashes", len(list))
+}
+
+func (x *hashIndex) add(id, s, artwork string) {
+	h, err := imagehash.Parse(s)
+	if err != nil {
+		return
+	}
+	x.mu.Lock()
+	x.hashes[id] = hashItem{hash: h, artwork: artwork}
+	x.mu.Unlock()
+}
+
+func (x *hashIndex) remove(id string) {
+	x.mu.Lock()
+	delete(x.hashes, id)
+	x.mu.Unlock()
+}
+
+// nearest 返回距离不超过 maxDist 的最相近的一张图，跳过属于 artwork 的图
+// 差分和多页作品的各页往往非常像，不能当成重复
+func (x *hashIndex) nearest(h uint64, maxDist int, artwork string) (id string, dist int, ok bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	dist = maxDist + 1
+	for k, v := range x.hashes {
+		if artwork != "" && v.artwork == artwork {
+			continue
+		}
+		if d := imagehash.Distance(h, v.hash); d < dist {
+			id, dist = k, d
+			if d == 0 {
+				break
+			}
+		}
+	}
+	return id, dist, dist <= maxDist
+}
+
+// FindSimilar 查找与 h 的汉明距离不超过 PHASH_DISTANCE 的已有图片，不和同一作品 (artwork) 的其它页比较
+// PHASH_DISTANCE <= 0 时关闭
+func (d *DB) FindSimilar(h uint64, artwork string) (id string, dist int, ok bool) {
+	if d.cfg.PHashDistance <= 0 {
+		return "", 0, false
+	}
+	return d.hashes.nearest(h, d.cfg.PHashDistance, artwork)
+}
+
+// GetImage 按 ID 读取已保存的记录，不存在时返回 nil
+func (d *DB) GetImage(postID string) (*ImageRecord, error) {
+	return d.store.GetImage(postID)
+}
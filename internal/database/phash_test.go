@@ -0,0 +1,48 @@
+package database
+
+import (
+	"testing"
+
+	"my-bot-go/internal/config"
+	"my-bot-go/internal/imagehash"
+)
+
+func TestFindSimilar(t *testing.T) {
+	d, _ := newTestDB(t, &config.Config{PHashDistance: 5})
+	d.indexRecord(ImageRecord{PostID: "pixiv_1_p0", Platform: "pixiv", ArtworkID: "1", PHash: imagehash.Format(0xff00)})
+	d.indexRecord(ImageRecord{PostID: "yande_9", Platform: "yande", ArtworkID: "9", PHash: imagehash.Format(0xffff0000)})
+
+	// 另一个作品里几乎一样的图
+	if id, dist, ok := d.FindSimilar(0xff01, "pixiv/2"); !ok || id != "pixiv_1_p0" || dist != 1 {
+		t.Fatalf("FindSimilar = %q, %d, %v", id, dist, ok)
+	}
+	// 同一作品的差分不算重复
+	if id, _, ok := d.FindSimilar(0xff01, "pixiv/1"); ok {
+		t.Fatalf("matched %s from the same artwork", id)
+	}
+	// 超过距离
+	if id, _, ok := d.FindSimilar(0xffff, "pixiv/2"); ok {
+		t.Fatalf("matched %s beyond PHASH_DISTANCE", id)
+	}
+}
+
+func TestFindSimilarDisabled(t *testing.T) {
+	d, _ := newTestDB(t, &config.Config{})
+	d.indexRecord(ImageRecord{PostID: "a", PHash: imagehash.Format(1)})
+	if _, _, ok := d.FindSimilar(1, ""); ok {
+		t.Fatal("PHASH_DISTANCE=0 should disable perceptual dedup")
+	}
+}
+
+func TestHashIndexLoadKeepsArtwork(t *testing.T) {
+	store := newFakeStore()
+	store.SaveImage(ImageRecord{PostID: "pixiv_1_p0", Platform: "pixiv", ArtworkID: "1", PHash: imagehash.Format(42)})
+	x := newHashIndex()
+	x.load(store)
+	if _, _, ok := x.nearest(42, 3, "pixiv/1"); ok {
+		t.Fatal("loaded hash lost its artwork key")
+	}
+	if id, _, ok := x.nearest(42, 3, ""); !ok || id != "pixiv_1_p0" {
+		t.Fatalf("nearest = %q, %v", id, ok)
+	}
+}
@@ -0,0 +1,234 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	queueRetryBase = 30 * time.Second
+	queueRetryMax  = 30 * time.Minute
+	queueTick      = 15 * time.Second
+)
+
+// QueueEntry 是写库失败后等待重试的一行
+type QueueEntry struct {
+	Row       ImageRecord `json:"row"`
+	Attempts  int         `json:"attempts"`
+	NextRetry time.Time   `json:"next_retry"`
+	LastError string      `json:"last_error"`
+
+	seq uint64 // 只在内存里用，重试结果按它对回原来那一条
+}
+
+// WriteQueue 把写库失败的行持久化到本地 JSON Lines 文件，按指数退避重试直到写入成功
+// 文件在每次变化后整体重写，重启后从文件恢复
+type WriteQueue struct {
+	path  string
+	store Store
+
+	mu      sync.Mutex
+	entries []QueueEntry
+	seq     uint64
+	retryMu sync.Mutex // 定时重试和手动 Flush 不同时进行
+
+	onSaved func(ImageRecord)
+}
+
+func NewWriteQueue(path string, store Store, onSaved func(ImageRecord)) *WriteQueue {
+	q := &WriteQueue{path: path, store: store, onSaved: onSaved}
+	q.load()
+	return q
+}
+
+// Push 加入一行，同一个 PostID 只保留最新的一条
+func (q *WriteQueue) Push(row ImageRecord, cause error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	entry := QueueEntry{Row: row, NextRetry: time.Now().Add(queueRetryBase), seq: q.seq}
+	if cause != nil {
+		entry.LastError = cause.Error()
+	}
+
+	for i, e := range q.entries {
+		if e.Row.PostID == row.PostID {
+			q.entries[i] = entry
+			q.save()
+			return
+		}
+	}
+	q.entries = append(q.entries, entry)
+	q.save()
+	log.Printf("📥 Queued %s for retry (%d pending)", row.PostID, len(q.entries))
+}
+
+// Entries 返回当前排队的行
+func (q *WriteQueue) Entries() []QueueEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := make([]QueueEntry, len(q.entries))
+	copy(list, q.entries)
+	return list
+}
+
+// Len 返回排队中的行数
+func (q *WriteQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// Run 定时重试到期的行，直到 ctx 结束
+func (q *WriteQueue) Run(ctx context.Context) {
+	ticker := time.NewTicker(queueTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		q.retry(false)
+	}
+}
+
+// Flush 忽略退避时间立即重试所有行，返回成功写入的条数和剩余条数
+func (q *WriteQueue) Flush() (saved, left int) {
+	return q.retry(true)
+}
+
+func (q *WriteQueue) retry(all bool) (saved, left int) {
+	q.retryMu.Lock()
+	defer q.retryMu.Unlock()
+	now := time.Now()
+
+	q.mu.Lock()
+	var due []QueueEntry
+	for _, e := range q.entries {
+		if all || !now.Before(e.NextRetry) {
+			due = append(due, e)
+		}
+	}
+	q.mu.Unlock()
+
+	if len(due) == 0 {
+		return 0, q.Len()
+	}
+
+	rows := make([]ImageRecord, len(due))
+	for i, e := range due {
+		rows[i] = e.Row
+	}
+	errs := q.store.SaveImages(rows)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// 重试期间同一个 PostID 可能被 Push 了更新的一行，它的 seq 不同，不能当成已写入
+	result := make(map[uint64]error, len(due))
+	for i, e := range due {
+		result[e.seq] = errs[i]
+	}
+
+	kept := q.entries[:0]
+	for _, e := range q.entries {
+		err, tried := result[e.seq]
+		if !tried {
+			kept = append(kept, e)
+			continue
+		}
+		if err == nil {
+			saved++
+			if q.onSaved != nil {
+				q.onSaved(e.Row)
+			}
+			continue
+		}
+		e.Attempts++
+		e.LastError = err.Error()
+		e.NextRetry = now.Add(retryBackoff(e.Attempts))
+		kept = append(kept, e)
+	}
+	q.entries = kept
+	q.save()
+
+	if saved > 0 {
+		log.Printf("📤 Retried queued rows: %d saved, %d pending", saved, len(q.entries))
+	}
+	return saved, len(q.entries)
+}
+
+func retryBackoff(attempts int) time.Duration {
+	d := queueRetryBase
+	for i := 0; i < attempts && d < queueRetryMax; i++ {
+		d *= 2
+	}
+	if d > queueRetryMax {
+		d = queueRetryMax
+	}
+	return d
+}
+
+func (q *WriteQueue) load() {
+	data, err := os.ReadFile(q.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("⚠️ Read write queue failed: %v", err)
+		}
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var e QueueEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			log.Printf("⚠️ Skipping corrupted write queue line: %v", err)
+			continue
+		}
+		q.seq++
+		e.seq = q.seq
+		q.entries = append(q.entries, e)
+	}
+	if len(q.entries) > 0 {
+		log.Printf("📂 Loaded %d pending rows from write queue", len(q.entries))
+	}
+}
+
+// save 需要持有 q.mu；先写临时文件再改名，避免写一半被打断
+func (q *WriteQueue) save() {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range q.entries {
+		if err := enc.Encode(e); err != nil {
+			log.Printf("⚠️ Save write queue failed: %v", err)
+			return
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(q.path), 0o755); err != nil {
+		log.Printf("⚠️ Save write queue failed: %v", err)
+		return
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		log.Printf("⚠️ Save write queue failed: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		log.Printf("⚠️ Save write queue failed: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// 重启后从 JSONL 文件恢复排队的行，写库恢复后能全部写进去
+func TestWriteQueueSurvivesRestart(t *testing.T) {
+	path := t.TempDir() + "/queue.jsonl"
+
+	broken := newFakeStore()
+	broken.fail = errors.New("d1 unavailable")
+	q := NewWriteQueue(path, broken, nil)
+	q.Push(ImageRecord{PostID: "a", Caption: "old"}, broken.fail)
+	q.Push(ImageRecord{PostID: "b"}, broken.fail)
+	q.Push(ImageRecord{PostID: "a", Caption: "new"}, broken.fail)
+	if saved, left := q.Flush(); saved != 0 || left != 2 {
+		t.Fatalf("flush on broken store = %d saved, %d left", saved, left)
+	}
+
+	store := newFakeStore()
+	var saved []string
+	q = NewWriteQueue(path, store, func(rec ImageRecord) { saved = append(saved, rec.PostID) })
+	entries := q.Entries()
+	if len(entries) != 2 || entries[0].Attempts != 1 || entries[0].LastError == "" {
+		t.Fatalf("reloaded entries = %+v", entries)
+	}
+
+	if n, left := q.Flush(); n != 2 || left != 0 {
+		t.Fatalf("flush after restart = %d saved, %d left", n, left)
+	}
+	if len(saved) != 2 {
+		t.Fatalf("onSaved called for %v", saved)
+	}
+	if rec, _ := store.GetImage("a"); rec == nil || rec.Caption != "new" {
+		t.Fatalf("row a = %+v, want the newest push", rec)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Fatalf("queue file not drained: %q", data)
+	}
+	if q = NewWriteQueue(path, store, nil); q.Len() != 0 {
+		t.Fatalf("reopened drained queue has %d rows", q.Len())
+	}
+}
+
+// blockingStore 在 SaveImages 里等测试放行，用来模拟重试期间有新的 Push
+type blockingStore struct {
+	*fakeStore
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) SaveImages(rows []ImageRecord) []error {
+	close(s.started)
+	<-s.release
+	return s.fakeStore.SaveImages(rows)
+}
+
+// 重试期间同一个 PostID 又进来一条更新的行，重试成功后这条不能被当成已写入删掉
+func TestWriteQueuePushDuringRetry(t *testing.T) {
+	store := &blockingStore{
+		fakeStore: newFakeStore(),
+		started:   make(chan struct{}),
+		release:   make(chan struct{}),
+	}
+	q := NewWriteQueue(t.TempDir()+"/queue.jsonl", store, nil)
+	q.Push(ImageRecord{PostID: "a", Caption: "old"}, nil)
+
+	done := make(chan int)
+	go func() {
+		saved, _ := q.Flush()
+		done <- saved
+	}()
+
+	<-store.started
+	q.Push(ImageRecord{PostID: "a", Caption: "new"}, errors.New("timeout"))
+	close(store.release)
+
+	if saved := <-done; saved != 0 {
+		t.Fatalf("flush reported %d saved, the retried entry was replaced", saved)
+	}
+	entries := q.Entries()
+	if len(entries) != 1 || entries[0].Row.Caption != "new" || entries[0].Attempts != 0 {
+		t.Fatalf("entries after retry = %+v, want the newer push kept", entries)
+	}
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"encoding/json"
+
+	"my-bot-go/internal/storage"
+)
+
+// ImageRecord 是 images 表里的一行
+type ImageRecord struct {
+	PostID   string `json:"id"`
+	FileID   string `json:"file_name"`
+	OriginID string `json:"origin_id"`
+	Caption  string `json:"caption"`
+	Artist   string `json:"artist"`
+	Tags     string `json:"tags"` // 空格分隔，只放真正的标签
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+
+	Platform  string `json:"platform"`   // 来源平台：pixiv / yande / mtcacg / TG-Forward ...
+	SourceURL string `json:"source_url"` // 原作品页面
+	ArtworkID string `json:"artwork_id"` // 原站的作品 ID
+	PageIndex int    `json:"page_index"` // 多页作品中的第几页，从 0 开始
+	R18       bool   `json:"r18"`
+	FileSize  int64  `json:"file_size"` // 原图字节数
+	MimeType  string `json:"mime_type"` // 原图类型，如 image/png
+	PHash     string `json:"phash"`     // 感知哈希 (dHash)，16 位十六进制
+	SHA256    string `json:"sha256"`    // 原图内容的 SHA-256，十六进制
+
+	// Locations 是这张图在各个上传后端的位置，FileID/OriginID 是其中默认给图库用的那一个
+	Locations []storage.Location `json:"storage,omitempty"`
+
+	// OriginalMode 是原图超过 Telegram 50MB 限制时的处理方式：reencode / storage / link / missing，正常发送时为空
+	OriginalMode string `json:"original_mode"`
+
+	// CanonicalID 是这张图在原站的 ID (见 internal/canonical)，与 PostID 不同时写库成功后记一条别名
+	// 不是 images 表的列，从库里读出来时为空
+	CanonicalID string `json:"canonical_id,omitempty"`
+}
+
+const insertImageSQL = "INSERT OR IGNORE INTO images (id, file_name, origin_id, caption, artist, tags, created_at, width, height, platform, source_url, artwork_id, page_index, r18, file_size, mime_type, phash, sha256, storage, original_mode) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+func (r ImageRecord) insertParams(createdAt int64) []interface{} {
+	r18 := 0
+	if r.R18 {
+		r18 = 1
+	}
+	var locations interface{}
+	if len(r.Locations) > 0 {
+		data, _ := json.Marshal(r.Locations)
+		locations = string(data)
+	}
+	return []interface{}{
+		r.PostID, r.FileID, r.OriginID, r.Caption, r.Artist, r.Tags, createdAt, r.Width, r.Height,
+		r.Platform, r.SourceURL, r.ArtworkID, r.PageIndex, r18, r.FileSize, r.MimeType, nullable(r.PHash), nullable(r.SHA256), locations,
+		nullable(r.OriginalMode),
+	}
+}
+
+// aliasParams 返回写别名表的参数，不需要别名时返回 nil
+func (r ImageRecord) aliasParams(createdAt int64) []interface{} {
+	if r.CanonicalID == "" || r.CanonicalID == r.PostID {
+		return nil
+	}
+	return []interface{}{r.CanonicalID, r.PostID, createdAt}
+}
+
+// recordFromRow 把 queryRows 返回的一行转换成 ImageRecord，NULL 列保持零值
+func recordFromRow(row map[string]interface{}) ImageRecord {
+	str := func(k string) string {
+		switch v := row[k].(type) {
+		case string:
+			return v
+		case []byte:
+			return string(v)
+		}
+		return ""
+	}
+	rec := ImageRecord{
+		PostID:    str("id"),
+		FileID:    str("file_name"),
+		OriginID:  str("origin_id"),
+		Caption:   str("caption"),
+		Artist:    str("artist"),
+		Tags:      str("tags"),
+		Width:     toInt(row["width"]),
+		Height:    toInt(row["height"]),
+		Platform:  str("platform"),
+		SourceURL: str("source_url"),
+		ArtworkID: str("artwork_id"),
+		PageIndex: toInt(row["page_index"]),
+		R18:       toInt(row["r18"]) != 0,
+		FileSize:  int64(toInt(row["file_size"])),
+		MimeType:  str("mime_type"),
+		PHash:     str("phash"),
+		SHA256:    str("sha256"),
+
+		OriginalMode: str("original_mode"),
+	}
+	if raw := str("storage"); raw != "" {
+		json.Unmarshal([]byte(raw), &rec.Locations)
+	}
+	return rec
+}
+
+// getImage 按 ID 读取一行，不存在时返回 nil
+func getImage(r sqlRunner, postID string) (*ImageRecord, error) {
+	rows, err := r.queryRows("SELECT * FROM images WHERE id = ? LIMIT 1", postID)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	rec := recordFromRow(rows[0])
+	return &rec, nil
+}
+
+// findBySHA256 返回任意一条内容哈希相同、已有 file_id 的记录，没有时返回 nil
+func findBySHA256(r sqlRunner, sum string) (*ImageRecord, error) {
+	rows, err := r.queryRows("SELECT * FROM images WHERE sha256 = ? AND file_name IS NOT NULL AND file_name != '' LIMIT 1", sum)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	rec := recordFromRow(rows[0])
+	return &rec, nil
+}
+
+// listHashes 返回所有带感知哈希的 ID -> 哈希和所属作品
+func listHashes(r sqlRunner) (map[string]HashEntry, error) {
+	rows, err := r.queryRows("SELECT id, phash, platform, artwork_id FROM images WHERE phash IS NOT NULL AND phash != ''")
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]HashEntry, len(rows))
+	for _, row := range rows {
+		rec := recordFromRow(row)
+		hashes[rec.PostID] = HashEntry{PHash: rec.PHash, Artwork: rec.ArtworkKey()}
+	}
+	return hashes, nil
+}
+
+// ArtworkKey 返回平台 + 原站作品 ID，同一作品的各页相同；没有作品 ID 时为空
+func (r ImageRecord) ArtworkKey() string {
+	if r.ArtworkID == "" {
+		return ""
+	}
+	return r.Platform + "/" + r.ArtworkID
+}
+
+// existsSQL 同时查 images 和别名表，别名只在对应的图片还在时才算数
+const existsSQL = `SELECT 1 FROM images WHERE id = ?
+UNION ALL
+SELECT 1 FROM image_aliases a JOIN images i ON i.id = a.image_id WHERE a.canonical_id = ?
+LIMIT 1`
+
+const insertAliasSQL = "INSERT OR IGNORE INTO image_aliases (canonical_id, image_id, created_at) VALUES (?, ?, ?)"
+
+// nullable 把空字符串存成 NULL
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite" // 纯 Go 驱动，无需 CGO
+)
+
+// SQLiteStore 把 images 表存到本地 SQLite 文件，用于离线运行、测试和自建部署
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite 同一时间只允许一个写入者，单连接避免 "database is locked"
+	db.SetMaxOpenConns(1)
+
+	s := &SQLiteStore{db: db}
+	if err := migrate(s); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLiteStore) exec(query string, params ...interface{}) error {
+	_, err := s.db.Exec(query, params...)
+	return err
+}
+
+func (s *SQLiteStore) queryRows(query string, params ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := s.db.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var list []map[string]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(cols))
+		for i, c := range cols {
+			row[c] = values[i]
+		}
+		list = append(list, row)
+	}
+	return list, rows.Err()
+}
+
+func (s *SQLiteStore) SaveImage(rec ImageRecord) error {
+	return s.SaveImages([]ImageRecord{rec})[0]
+}
+
+// SaveImages 在一个事务里写入，单行失败不影响其它行
+func (s *SQLiteStore) SaveImages(rows []ImageRecord) []error {
+	errs := make([]error, len(rows))
+	fail := func(err error) []error {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fail(err)
+	}
+	now := time.Now().Unix()
+	for i, r := range rows {
+		if _, errs[i] = tx.Exec(insertImageSQL, r.insertParams(now)...); errs[i] != nil {
+			continue
+		}
+		if alias := r.aliasParams(now); alias != nil {
+			_, errs[i] = tx.Exec(insertAliasSQL, alias...)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+	return errs
+}
+
+func (s *SQLiteStore) Exists(postID string) (bool, error) {
+	var one int
+	err := s.db.QueryRow(existsSQL, postID, postID).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *SQLiteStore) DeleteImage(postID string) error {
+	if _, err := s.db.Exec("DELETE FROM images WHERE id = ?", postID); err != nil {
+		return err
+	}
+	_, err := s.db.Exec("DELETE FROM image_aliases WHERE image_id = ?", postID)
+	return err
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteStore) GetImage(postID string) (*ImageRecord, error) {
+	return getImage(s, postID)
+}
+
+func (s *SQLiteStore) ListHashes() (map[string]HashEntry, error) {
+	return listHashes(s)
+}
+
+func (s *SQLiteStore) FindBySHA256(sum string) (*ImageRecord, error) {
+	return findBySHA256(s, sum)
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"my-bot-go/internal/config"
+	"my-bot-go/internal/storage"
+)
+
+func newTestSQLite(t *testing.T, path string) *SQLiteStore {
+	t.Helper()
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSQLiteStoreSaveAndGet(t *testing.T) {
+	s := newTestSQLite(t, t.TempDir()+"/images.db")
+
+	rec := ImageRecord{
+		PostID: "pixiv_100_p1", FileID: "file", OriginID: "origin",
+		Caption: "cap", Artist: "someone", Tags: "a b", Width: 800, Height: 600,
+		Platform: "pixiv", SourceURL: "https://www.pixiv.net/artworks/100", ArtworkID: "100",
+		PageIndex: 1, R18: true, FileSize: 1234, MimeType: "image/png",
+		PHash: "0123456789abcdef", SHA256: "deadbeef",
+		Locations:    []storage.Location{{Backend: "telegram", Ref: "origin", Preview: "file"}, {Backend: "s3", Ref: "pixiv/100_p1.png"}},
+		OriginalMode: "reencode",
+	}
+	if err := s.SaveImage(rec); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetImage(rec.PostID)
+	if err != nil || got == nil {
+		t.Fatalf("GetImage = %v, %v", got, err)
+	}
+	if !reflect.DeepEqual(*got, rec) {
+		t.Fatalf("round trip =\n%+v\nwant\n%+v", *got, rec)
+	}
+	if missing, err := s.GetImage("nope"); missing != nil || err != nil {
+		t.Fatalf("GetImage(missing) = %v, %v", missing, err)
+	}
+
+	// 同一个 ID 再写一次不会覆盖已有的行
+	if err := s.SaveImage(ImageRecord{PostID: rec.PostID, FileID: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetImage(rec.PostID); got.FileID != "file" {
+		t.Fatalf("existing row overwritten: %+v", got)
+	}
+
+	if found, err := s.FindBySHA256("deadbeef"); err != nil || found == nil || found.PostID != rec.PostID {
+		t.Fatalf("FindBySHA256 = %v, %v", found, err)
+	}
+	hashes, err := s.ListHashes()
+	if err != nil || hashes[rec.PostID] != (HashEntry{PHash: rec.PHash, Artwork: "pixiv/100"}) {
+		t.Fatalf("ListHashes = %v, %v", hashes, err)
+	}
+}
+
+func TestSQLiteStoreExistsAndDelete(t *testing.T) {
+	s := newTestSQLite(t, t.TempDir()+"/images.db")
+
+	errs := s.SaveImages([]ImageRecord{
+		{PostID: "mtcacg_1", FileID: "f1", CanonicalID: "pixiv_7_p0"},
+		{PostID: "yande_2", FileID: "f2"},
+	})
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("row %d: %v", i, err)
+		}
+	}
+
+	for _, id := range []string{"mtcacg_1", "pixiv_7_p0", "yande_2"} {
+		if ok, err := s.Exists(id); err != nil || !ok {
+			t.Errorf("Exists(%s) = %v, %v", id, ok, err)
+		}
+	}
+	if ok, _ := s.Exists("pixiv_8_p0"); ok {
+		t.Error("Exists reported an unknown ID")
+	}
+
+	// 删除图片后，指向它的别名也不再算数
+	if err := s.DeleteImage("mtcacg_1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"mtcacg_1", "pixiv_7_p0"} {
+		if ok, _ := s.Exists(id); ok {
+			t.Errorf("%s still exists after delete", id)
+		}
+	}
+	if ok, _ := s.Exists("yande_2"); !ok {
+		t.Error("delete removed an unrelated row")
+	}
+}
+
+// 走 DB 的完整流程：写库后进历史，重新打开文件后还能查到，删除后从历史里去掉
+func TestSQLiteHistory(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		StoreBackend:   "sqlite",
+		SQLitePath:     dir + "/images.db",
+		WriteQueuePath: dir + "/queue.jsonl",
+		BatchSize:      10,
+		BatchWait:      time.Hour,
+	}
+	d, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.SaveImage(ImageRecord{PostID: "mtcacg_1", FileID: "f1", CanonicalID: "pixiv_7_p0"}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	d.QueueImage(ImageRecord{PostID: "yande_2", FileID: "f2"}, func(err error) { done <- err })
+	d.Flush()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"mtcacg_1", "pixiv_7_p0", "yande_2"} {
+		if !d.IsSeen(id) {
+			t.Errorf("%s not in history after save", id)
+		}
+	}
+	d.Close()
+
+	// 内存历史是空的，查重靠 SQLite 文件
+	d, err = New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if d.HistorySize() != 0 {
+		t.Fatalf("fresh DB has %d history entries", d.HistorySize())
+	}
+	if !d.CheckExists("pixiv_7_p0") || !d.CheckExists("yande_2") {
+		t.Fatal("rows lost after reopening the SQLite file")
+	}
+	if !d.IsSeen("yande_2") {
+		t.Error("CheckExists hit not cached in history")
+	}
+
+	if err := d.DeleteImage("yande_2"); err != nil {
+		t.Fatal(err)
+	}
+	if d.IsSeen("yande_2") || d.CheckExists("yande_2") {
+		t.Error("yande_2 still seen after delete")
+	}
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"fmt"
+	"my-bot-go/internal/config"
+)
+
+// Store 是 images 表的存储后端，目前有 D1 (HTTP API) 和本地 SQLite 两种实现
+type Store interface {
+	SaveImage(rec ImageRecord) error
+	// SaveImages 批量写入，返回与 rows 一一对应的错误
+	SaveImages(rows []ImageRecord) []error
+	Exists(postID string) (bool, error)
+	DeleteImage(postID string) error
+	// GetImage 按 ID 读取一行，不存在时返回 nil, nil
+	GetImage(postID string) (*ImageRecord, error)
+	// FindBySHA256 按原图内容哈希查找已上传过的记录，没有时返回 nil, nil
+	FindBySHA256(sum string) (*ImageRecord, error)
+	// ListHashes 返回所有已记录感知哈希的 ID -> 哈希和所属作品
+	ListHashes() (map[string]HashEntry, error)
+	Close() error
+}
+
+// OpenStore 按 STORE_BACKEND 选择存储后端，默认 d1
+func OpenStore(cfg *config.Config) (Store, error) {
+	switch cfg.StoreBackend {
+	case "", "d1":
+		d1 := NewD1Client(cfg)
+		if err := migrate(d1); err != nil {
+			return nil, fmt.Errorf("D1 migration failed: %w", err)
+		}
+		return d1, nil
+	case "sqlite":
+		return NewSQLiteStore(cfg.SQLitePath)
+	default:
+		return nil, fmt.Errorf("unknown STORE_BACKEND: %s", cfg.StoreBackend)
+	}
+}
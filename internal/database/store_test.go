@@ -0,0 +1,102 @@
+package database
+
+import (
+	"sync"
+	"testing"
+
+	"my-bot-go/internal/config"
+)
+
+// fakeStore 是放在内存里的 Store，测试里代替 D1/SQLite
+type fakeStore struct {
+	mu   sync.Mutex
+	rows map[string]ImageRecord
+	fail error // 不为 nil 时所有写入都返回它
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{rows: make(map[string]ImageRecord)}
+}
+
+func (s *fakeStore) SaveImage(rec ImageRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		return s.fail
+	}
+	s.rows[rec.PostID] = rec
+	return nil
+}
+
+func (s *fakeStore) SaveImages(rows []ImageRecord) []error {
+	errs := make([]error, len(rows))
+	for i, rec := range rows {
+		errs[i] = s.SaveImage(rec)
+	}
+	return errs
+}
+
+func (s *fakeStore) Exists(postID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.rows[postID]
+	return ok, nil
+}
+
+func (s *fakeStore) DeleteImage(postID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.rows, postID)
+	return nil
+}
+
+func (s *fakeStore) GetImage(postID string) (*ImageRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.rows[postID]
+	if !ok {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+func (s *fakeStore) FindBySHA256(sum string) (*ImageRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rec := range s.rows {
+		if rec.SHA256 == sum {
+			rec := rec
+			return &rec, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *fakeStore) ListHashes() (map[string]HashEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hashes := make(map[string]HashEntry)
+	for id, rec := range s.rows {
+		if rec.PHash != "" {
+			hashes[id] = HashEntry{PHash: rec.PHash, Artwork: rec.ArtworkKey()}
+		}
+	}
+	return hashes, nil
+}
+
+func (s *fakeStore) Close() error { return nil }
+
+// newTestDB 返回使用 fakeStore 的 DB，写库队列放在测试的临时目录里
+func newTestDB(t *testing.T, cfg *config.Config) (*DB, *fakeStore) {
+	t.Helper()
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	if cfg.WriteQueuePath == "" {
+		cfg.WriteQueuePath = t.TempDir() + "/queue.jsonl"
+	}
+	store := newFakeStore()
+	d := newDB(cfg, store)
+	t.Cleanup(func() { d.Close() })
+	return d, store
+}
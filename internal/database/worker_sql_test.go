@@ -0,0 +1,76 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// workerSQL 从 web-worker/src/logic.js 里读出 const NAME = "..." 形式的 SQL，测试跑的是 Worker 真正执行的语句
+func workerSQL(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "..", "web-worker", "src", "logic.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := regexp.MustCompile(`const ` + name + ` = "([^"]+)";`).FindSubmatch(data)
+	if m == nil {
+		t.Fatalf("%s not found in logic.js", name)
+	}
+	return string(m[1])
+}
+
+func TestWorkerHistorySeed(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "images.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, id := range []string{"pixiv_1_p0", "yande_2"} {
+		if err := s.SaveImage(ImageRecord{PostID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	table, seed := workerSQL(t, "HISTORY_TABLE_SQL"), workerSQL(t, "HISTORY_SEED_SQL")
+	if err := s.exec(table); err != nil {
+		t.Fatalf("history table: %v", err)
+	}
+	// 第二次执行时日志已经有内容，不能重复打底
+	for i := 0; i < 2; i++ {
+		if err := s.exec(seed); err != nil {
+			t.Fatalf("seed run %d: %v", i+1, err)
+		}
+	}
+
+	rows, err := s.queryRows("SELECT id, op FROM history_log ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0]["id"] != "pixiv_1_p0" || rows[1]["id"] != "yande_2" || rows[0]["op"] != "add" {
+		t.Fatalf("history_log = %v, want both images seeded once as add", rows)
+	}
+}
+
+// Worker 只吞掉 images 表不存在的错误，这里确认 SQLite 的报错里确实有 "no such table"
+func TestWorkerHistorySeedWithoutImages(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "images.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.exec("DROP TABLE images"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.exec(workerSQL(t, "HISTORY_TABLE_SQL")); err != nil {
+		t.Fatal(err)
+	}
+	err = s.exec(workerSQL(t, "HISTORY_SEED_SQL"))
+	if err == nil || !strings.Contains(strings.ToLower(err.Error()), "no such table") {
+		t.Fatalf("seed without images = %v, want a no such table error", err)
+	}
+}
@@ -0,0 +1,64 @@
+package imagehash
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/bits"
+	"strconv"
+
+	"github.com/nfnt/resize"
+	_ "golang.org/x/image/webp"
+)
+
+// DHash 计算 64 位差值哈希：缩成 9x8 灰度图，每行比较相邻像素的明暗
+// 对缩放、重新压缩、轻微调色不敏感，适合找“同一张图的不同版本”
+func DHash(img image.Image) uint64 {
+	small := resize.Resize(9, 8, img, resize.Bilinear)
+	b := small.Bounds()
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			left := luminance(small, b.Min.X+x, b.Min.Y+y)
+			right := luminance(small, b.Min.X+x+1, b.Min.Y+y)
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// FromBytes 解码图片并计算 DHash
+func FromBytes(data []byte) (uint64, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	return DHash(img), nil
+}
+
+// Distance 返回两个哈希的汉明距离，0 表示几乎相同
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Format 把哈希转换成 16 位十六进制字符串，用于存库
+func Format(h uint64) string {
+	return fmt.Sprintf("%016x", h)
+}
+
+// Parse 解析 Format 输出的字符串
+func Parse(s string) (uint64, error) {
+	return strconv.ParseUint(s, 16, 64)
+}
+
+func luminance(img image.Image, x, y int) uint32 {
+	r, g, b, _ := img.At(x, y).RGBA()
+	return (299*r + 587*g + 114*b) / 1000
+}
@@ -0,0 +1,106 @@
+package imagehash
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/nfnt/resize"
+)
+
+// gradient 生成左右渐变加几块色块的测试图，flip 时渐变方向相反
+func gradient(w, h int, flip bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(x * 255 / w)
+			if flip {
+				v = 255 - v
+			}
+			if (x/(w/4)+y/(h/4))%3 == 0 {
+				v /= 2
+			}
+			img.Set(x, y, color.RGBA{v, v, uint8(y * 255 / h), 255})
+		}
+	}
+	return img
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b uint64
+		want int
+	}{
+		{0, 0, 0},
+		{0, 1, 1},
+		{0xff, 0x0f, 4},
+		{0, ^uint64(0), 64},
+		{0xaaaaaaaaaaaaaaaa, 0x5555555555555555, 64},
+	}
+	for _, tt := range tests {
+		if got := Distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("Distance(%x, %x) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestFormatParse(t *testing.T) {
+	for _, h := range []uint64{0, 1, 0xdeadbeef, ^uint64(0)} {
+		s := Format(h)
+		if len(s) != 16 {
+			t.Fatalf("Format(%x) = %q, want 16 hex digits", h, s)
+		}
+		got, err := Parse(s)
+		if err != nil || got != h {
+			t.Fatalf("Parse(%q) = %x, %v, want %x", s, got, err, h)
+		}
+	}
+	if _, err := Parse("not-a-hash"); err == nil {
+		t.Fatal("Parse accepted garbage")
+	}
+}
+
+func TestDHashSimilarImages(t *testing.T) {
+	orig := gradient(640, 480, false)
+	base := DHash(orig)
+
+	// 缩放后重新压缩成 JPEG，哈希几乎不变
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, resize.Resize(320, 240, orig, resize.Bilinear), &jpeg.Options{Quality: 70}); err != nil {
+		t.Fatal(err)
+	}
+	small, err := FromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := Distance(base, small); d > 5 {
+		t.Errorf("resized JPEG distance = %d, want <= 5", d)
+	}
+
+	// PNG 无损保存，哈希完全相同
+	buf.Reset()
+	if err := png.Encode(&buf, orig); err != nil {
+		t.Fatal(err)
+	}
+	same, err := FromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same != base {
+		t.Errorf("PNG round trip changed hash: %s vs %s", Format(same), Format(base))
+	}
+
+	// 明暗方向相反的图差别很大
+	if d := Distance(base, DHash(gradient(640, 480, true))); d < 20 {
+		t.Errorf("different image distance = %d, want >= 20", d)
+	}
+}
+
+func TestFromBytesInvalid(t *testing.T) {
+	if _, err := FromBytes([]byte("not an image")); err == nil {
+		t.Fatal("FromBytes accepted garbage")
+	}
+}
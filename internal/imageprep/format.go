@@ -0,0 +1,19 @@
+package imageprep
+
+import (
+	"bytes"
+	"image"
+	"net/http"
+)
+
+// DetectMIME 按文件内容判断图片的 MIME 类型
+// 先认 AVIF (http.DetectContentType 不认识)，再用已注册的解码器读文件头，都不行时退回 http.DetectContentType
+func DetectMIME(data []byte) string {
+	if isAVIF(data) {
+		return "image/avif"
+	}
+	if _, format, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		return "image/" + format
+	}
+	return http.DetectContentType(data)
+}
@@ -0,0 +1,65 @@
+package imageprep
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// OptimizePNG 无损地重新压缩 PNG：颜色不超过 256 种时转成调色板，再用最高压缩级别编码
+// 只处理 PNG，其它格式转成 PNG 只会更大，返回 ErrUnsupported
+func OptimizePNG(data []byte) ([]byte, error) {
+	if _, format, err := image.DecodeConfig(bytes.NewReader(data)); err != nil || format != "png" {
+		return nil, fmt.Errorf("%w: not a PNG", ErrUnsupported)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if p := toPaletted(img); p != nil {
+		img = p
+	}
+
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// toPaletted 在颜色不超过 256 种时返回等价的调色板图，否则返回 nil
+// 只处理 8 位的图，16 位的颜色放不进 PNG 调色板
+func toPaletted(img image.Image) *image.Paletted {
+	switch img.(type) {
+	case *image.NRGBA, *image.RGBA, *image.Gray:
+	default:
+		return nil
+	}
+	b := img.Bounds()
+	index := make(map[color.Color]uint8)
+	var palette color.Palette
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.At(x, y)
+			if _, ok := index[c]; ok {
+				continue
+			}
+			if len(palette) == 256 {
+				return nil
+			}
+			index[c] = uint8(len(palette))
+			palette = append(palette, c)
+		}
+	}
+
+	p := image.NewPaletted(b, palette)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			p.SetColorIndex(x, y, index[img.At(x, y)])
+		}
+	}
+	return p
+}
@@ -0,0 +1,248 @@
+// Package imageprep 把任意来源的图片整理成 Telegram 能直接当 photo 发送的 JPEG
+//
+// Telegram 对 sendPhoto 的限制：文件不超过 10MB，宽 + 高不超过 10000，宽高比不超过 20
+// 已经满足限制的 JPEG/PNG 原样返回，其它情况按 “先定尺寸、再二分查找质量” 重新编码
+package imageprep
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"math"
+	"strconv"
+	"strings"
+
+	_ "github.com/gen2brain/avif" // libavif 编译成 WASM 后用 wazero 运行，不需要 CGO
+	"github.com/nfnt/resize"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	MaxPhotoBytes = 10 * 1024 * 1024
+	MaxSideSum    = 10000
+	MaxAspect     = 20
+
+	maxQuality  = 95
+	goodQuality = 70 // 低于这个质量之前先缩小尺寸
+	minQuality  = 30
+	maxRescales = 6
+)
+
+// ErrUnsupported 表示图片格式无法解码 (不认识的格式或者文件头已经损坏)
+var ErrUnsupported = errors.New("unsupported image format")
+
+// Options 是处理参数，零值使用 Telegram 的限制和白色背景
+type Options struct {
+	MaxBytes   int64       // 输出的最大字节数
+	Background color.Color // 透明部分铺的底色，也用来补齐过长的图
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = MaxPhotoBytes
+	}
+	if o.Background == nil {
+		o.Background = color.White
+	}
+	return o
+}
+
+// Result 是处理结果
+type Result struct {
+	Data    []byte
+	Width   int
+	Height  int
+	Changed bool // false 表示原样返回
+}
+
+// ForTelegram 返回可以直接用 sendPhoto 发送的图片，支持 JPEG/PNG/GIF/WebP/AVIF 输入
+// Telegram 的 photo 不收 WebP/AVIF 等格式，它们总是重新编码成 JPEG
+func ForTelegram(data []byte, opts Options) (*Result, error) {
+	opts = opts.withDefaults()
+
+	conf, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+
+	// JPEG 不带旋转、PNG 不透明，且尺寸和大小都满足时原样发送，避免无谓的二次压缩
+	fits := int64(len(data)) <= opts.MaxBytes && fitsTelegram(conf.Width, conf.Height)
+	if fits && format == "jpeg" && orientation == 1 {
+		return &Result{Data: data, Width: conf.Width, Height: conf.Height}, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", format, err)
+	}
+	if fits && format == "png" && isOpaque(img) {
+		return &Result{Data: data, Width: conf.Width, Height: conf.Height}, nil
+	}
+
+	img = applyOrientation(img, orientation)
+	img = flatten(img, opts.Background)
+	img = fitSides(img)
+	img = padAspect(img, opts.Background)
+
+	out, err := encodeWithin(img, opts.MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	return &Result{Data: out, Width: b.Dx(), Height: b.Dy(), Changed: true}, nil
+}
+
+func fitsTelegram(w, h int) bool {
+	if w <= 0 || h <= 0 || w+h > MaxSideSum {
+		return false
+	}
+	long, short := w, h
+	if short > long {
+		long, short = short, long
+	}
+	return float64(long)/float64(short) <= MaxAspect
+}
+
+// isAVIF 按 ISO BMFF 的 ftyp 品牌识别 AVIF
+func isAVIF(data []byte) bool {
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	brand := string(data[8:12])
+	return brand == "avif" || brand == "avis"
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// flatten 把透明像素铺到背景色上，JPEG 没有透明通道，直接编码会变成黑底
+func flatten(img image.Image, bg color.Color) image.Image {
+	if isOpaque(img) {
+		return img
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+// fitSides 等比缩小到宽 + 高不超过 MaxSideSum
+func fitSides(img image.Image) image.Image {
+	b := img.Bounds()
+	if b.Dx()+b.Dy() <= MaxSideSum {
+		return img
+	}
+	return scale(img, float64(MaxSideSum)/float64(b.Dx()+b.Dy()))
+}
+
+// padAspect 宽高比超过 MaxAspect 的长图没法缩放解决，两侧补背景色到刚好满足
+func padAspect(img image.Image, bg color.Color) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	nw, nh := w, h
+	if h > w*MaxAspect {
+		nw = int(math.Ceil(float64(h) / MaxAspect))
+	} else if w > h*MaxAspect {
+		nh = int(math.Ceil(float64(w) / MaxAspect))
+	} else {
+		return img
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, nw, nh))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	offset := image.Pt((nw-w)/2, (nh-h)/2)
+	draw.Draw(dst, image.Rectangle{Min: offset, Max: offset.Add(image.Pt(w, h))}, img, b.Min, draw.Src)
+	// 补边之后宽 + 高可能又超了
+	return fitSides(dst)
+}
+
+func scale(img image.Image, ratio float64) image.Image {
+	b := img.Bounds()
+	w := uint(math.Max(1, math.Floor(float64(b.Dx())*ratio)))
+	h := uint(math.Max(1, math.Floor(float64(b.Dy())*ratio)))
+	return resize.Resize(w, h, img, resize.Lanczos3)
+}
+
+// encodeWithin 先在 goodQuality 以上二分查找能放进 maxBytes 的最高质量，
+// 放不下就按体积比例缩小尺寸再找，缩了几轮还不行才继续降低质量
+func encodeWithin(img image.Image, maxBytes int64) ([]byte, error) {
+	for i := 0; i < maxRescales; i++ {
+		data, ok, err := searchQuality(img, goodQuality, maxQuality, maxBytes)
+		if err != nil || ok {
+			return data, err
+		}
+		// data 是 goodQuality 下的结果，JPEG 体积大致和像素数成正比
+		ratio := math.Sqrt(float64(maxBytes)/float64(len(data))) * 0.95
+		img = scale(img, ratio)
+	}
+
+	data, ok, err := searchQuality(img, minQuality, goodQuality, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("cannot fit image into %d bytes", maxBytes)
+	}
+	return data, nil
+}
+
+// searchQuality 返回 [lo, hi] 内能放进 maxBytes 的最高质量的编码结果
+// 一个都放不下时返回质量为 lo 的结果和 false
+func searchQuality(img image.Image, lo, hi int, maxBytes int64) ([]byte, bool, error) {
+	var best, lowest []byte
+	for lo <= hi {
+		q := (lo + hi) / 2
+		data, err := encodeJPEG(img, q)
+		if err != nil {
+			return nil, false, err
+		}
+		if int64(len(data)) <= maxBytes {
+			best = data
+			lo = q + 1
+		} else {
+			lowest = data
+			hi = q - 1
+		}
+	}
+	if best != nil {
+		return best, true, nil
+	}
+	return lowest, false, nil
+}
+
+func encodeJPEG(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, fmt.Errorf("encode error: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseColor 解析 #rrggbb 或 rrggbb 形式的颜色
+func ParseColor(s string) (color.Color, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(s) != 6 {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xFF}, nil
+}
@@ -0,0 +1,83 @@
+package imageprep
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"testing"
+)
+
+func TestForTelegramAVIF(t *testing.T) {
+	// 64x48，左半边不透明的红色，右半边全透明
+	data, err := os.ReadFile("testdata/alpha.avif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mime := DetectMIME(data); mime != "image/avif" {
+		t.Fatalf("DetectMIME = %s, want image/avif", mime)
+	}
+
+	res, err := ForTelegram(data, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Changed || res.Width != 64 || res.Height != 48 {
+		t.Fatalf("got %dx%d changed=%v, want 64x48 re-encoded", res.Width, res.Height, res.Changed)
+	}
+	out, format, err := image.Decode(bytes.NewReader(res.Data))
+	if err != nil || format != "jpeg" {
+		t.Fatalf("output is %s (%v), want jpeg", format, err)
+	}
+	if r, g, b, _ := out.At(8, 24).RGBA(); r>>8 < 180 || g>>8 > 80 || b>>8 > 80 {
+		t.Errorf("left half = %v, want red", out.At(8, 24))
+	}
+	if r, g, b, _ := out.At(56, 24).RGBA(); r>>8 < 230 || g>>8 < 230 || b>>8 < 230 {
+		t.Errorf("transparent half = %v, want the white background", out.At(56, 24))
+	}
+}
+
+func TestForTelegramUnsupported(t *testing.T) {
+	if _, err := ForTelegram([]byte("definitely not an image"), Options{}); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("ForTelegram(garbage) error = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestForTelegramKeepsFittingJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 40, 30)), nil); err != nil {
+		t.Fatal(err)
+	}
+	res, err := ForTelegram(buf.Bytes(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Changed || !bytes.Equal(res.Data, buf.Bytes()) {
+		t.Fatal("a JPEG within the limits should be sent as is")
+	}
+}
+
+func TestForTelegramFlattensAndPadsPNG(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 300)) // 全透明，宽高比 30
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	res, err := ForTelegram(buf.Bytes(), Options{Background: color.Black})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Changed || res.Width != 15 || res.Height != 300 {
+		t.Fatalf("got %dx%d changed=%v, want 15x300 re-encoded", res.Width, res.Height, res.Changed)
+	}
+	out, err := jpeg.Decode(bytes.NewReader(res.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, b, _ := out.At(7, 150).RGBA(); r > 0x1000 || g > 0x1000 || b > 0x1000 {
+		t.Fatalf("transparent pixels should become the background, got %v", out.At(7, 150))
+	}
+}
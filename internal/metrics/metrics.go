@@ -0,0 +1,130 @@
+// Package metrics 记录每个图源的运行情况，爬虫边跑边更新，/status 读取
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Registry 按图源名字保存统计
+type Registry struct {
+	mu      sync.Mutex
+	sources map[string]*Source
+}
+
+func NewRegistry() *Registry {
+	return &Registry{sources: make(map[string]*Source)}
+}
+
+// Source 返回名字对应的统计，没有时创建
+func (r *Registry) Source(name string) *Source {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.sources[name]
+	if s == nil {
+		s = NewSource(name)
+		r.sources[name] = s
+	}
+	return s
+}
+
+// Snapshot 按名字顺序返回所有图源的统计
+func (r *Registry) Snapshot() []SourceStats {
+	r.mu.Lock()
+	list := make([]*Source, 0, len(r.sources))
+	for _, s := range r.sources {
+		list = append(list, s)
+	}
+	r.mu.Unlock()
+
+	stats := make([]SourceStats, len(list))
+	for i, s := range list {
+		stats[i] = s.Stats()
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// SourceStats 是一个图源的统计快照，计数是最近一轮 (正在运行时是这一轮) 的
+type SourceStats struct {
+	Name      string
+	Running   bool
+	Runs      int // 启动以来跑了几轮
+	LastStart time.Time
+	LastEnd   time.Time
+	NextRun   time.Time // 调度器排好的下一次运行时间，零值表示未知
+	LastError string
+
+	Found   int // 列出的候选作品
+	Sent    int // 发到频道的图
+	Skipped int // 已经发过、重复或相似而跳过的
+	Failed  int // 抓取、下载或上传失败的
+}
+
+// Source 是一个图源的统计，方法都可以在 nil 上调用，方便不需要统计的调用方传 nil
+type Source struct {
+	mu    sync.Mutex
+	stats SourceStats
+}
+
+// NewSource 创建不放进 Registry 的统计
+func NewSource(name string) *Source {
+	return &Source{stats: SourceStats{Name: name}}
+}
+
+func (s *Source) update(fn func(st *SourceStats)) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	fn(&s.stats)
+	s.mu.Unlock()
+}
+
+// Start 开始新的一轮，清零上一轮的计数
+func (s *Source) Start() {
+	s.update(func(st *SourceStats) {
+		st.Running = true
+		st.Runs++
+		st.LastStart = time.Now()
+		st.LastError = ""
+		st.Found, st.Sent, st.Skipped, st.Failed = 0, 0, 0, 0
+	})
+}
+
+// End 结束这一轮，err 不为 nil 时记为最近的错误
+func (s *Source) End(err error) {
+	s.update(func(st *SourceStats) {
+		st.Running = false
+		st.LastEnd = time.Now()
+		if err != nil {
+			st.LastError = err.Error()
+		}
+	})
+}
+
+// Error 记录一个不中断这一轮的错误
+func (s *Source) Error(err error) {
+	s.update(func(st *SourceStats) { st.LastError = err.Error() })
+}
+
+func (s *Source) AddFound(n int)   { s.update(func(st *SourceStats) { st.Found += n }) }
+func (s *Source) AddSent(n int)    { s.update(func(st *SourceStats) { st.Sent += n }) }
+func (s *Source) AddSkipped(n int) { s.update(func(st *SourceStats) { st.Skipped += n }) }
+func (s *Source) AddFailed(n int)  { s.update(func(st *SourceStats) { st.Failed += n }) }
+
+// SetNextRun 由调度器在排好下一次运行时调用
+func (s *Source) SetNextRun(t time.Time) {
+	s.update(func(st *SourceStats) { st.NextRun = t })
+}
+
+// Stats 返回当前统计的拷贝
+func (s *Source) Stats() SourceStats {
+	if s == nil {
+		return SourceStats{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
@@ -29,6 +29,7 @@ type PixivDetailResp struct {
 		IllustTitle string `json:"illustTitle"`
 		UserName    string `json:"userName"`
 		IllustType  int    `json:"illustType"` // 2=动图
+		XRestrict   int    `json:"xRestrict"`  // 0=全年龄 1=R-18 2=R-18G
 		Tags        struct {
 			Tags []struct {
 				Tag string `json:"tag"`
@@ -42,6 +43,7 @@ type Illust struct {
 	Title    string
 	Artist   string
 	Tags     string
+	R18      bool
 	Pages    []PixivPage
 }
 
@@ -91,6 +93,7 @@ func GetIllust(id string, cookie string) (*Illust, error) {
 		Title:  detail.Body.IllustTitle,
 		Artist: detail.Body.UserName,
 		Tags:   strings.Join(tagStrs, " "),
+		R18:    detail.Body.XRestrict > 0,
 		Pages:  pages.Body,
 	}, nil
 }
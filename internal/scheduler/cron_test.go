@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"@yearly",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2024-01-10 是星期三
+	base := time.Date(2024, 1, 10, 10, 17, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", base, time.Date(2024, 1, 10, 10, 18, 0, 0, time.UTC)},
+		{"*/30 * * * *", base, time.Date(2024, 1, 10, 10, 30, 0, 0, time.UTC)},
+		{"15 * * * *", base, time.Date(2024, 1, 10, 11, 15, 0, 0, time.UTC)},
+		{"0 8-9 * * *", base, time.Date(2024, 1, 11, 8, 0, 0, 0, time.UTC)},
+		{"5/20 * * * *", base, time.Date(2024, 1, 10, 10, 25, 0, 0, time.UTC)},
+		{"0 12,18 * * *", base, time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)},
+		{"@hourly", base, time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC)},
+		{"@daily", base, time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", base, time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", base, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		// 周日写 7 和写 0 一样
+		{"0 0 * * 7", base, time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		// 日和周都限定时满足任一即可：1 号或星期五
+		{"0 0 1 * 5", base, time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},
+		// 跨年、闰年
+		{"0 0 29 2 *", base, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", base, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// 正好在匹配的分钟上时取下一次
+		{"17 10 * * *", base, time.Date(2024, 1, 11, 10, 17, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+		}
+		if got := c.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%q.Next(%v) = %v, want %v", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestCronNextNever(t *testing.T) {
+	c, err := ParseCron("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Next(time.Now()); !got.IsZero() {
+		t.Fatalf("Next = %v, want zero time", got)
+	}
+}
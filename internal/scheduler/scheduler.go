@@ -0,0 +1,161 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Job 是一个周期任务。Cron 非空时优先于 Interval
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Cron     string
+	Jitter   time.Duration // 每次触发额外随机延后 [0, Jitter)
+	Delay    time.Duration // 首次运行前的错峰延迟（仅 Interval 模式）
+	Run      func(ctx context.Context)
+
+	// OnScheduled 在每次排好下一次运行时间后调用，可以为 nil
+	OnScheduled func(next time.Time)
+}
+
+type job struct {
+	Job
+	cron    *Cron
+	running atomic.Bool
+}
+
+// Scheduler 负责按各自的节奏运行所有任务
+type Scheduler struct {
+	mu   sync.Mutex
+	jobs []*job
+	wg   sync.WaitGroup
+}
+
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+// Add 注册一个任务，需在 Start 之前调用
+func (s *Scheduler) Add(j Job) error {
+	if j.Run == nil {
+		return fmt.Errorf("job %s: Run is nil", j.Name)
+	}
+
+	jb := &job{Job: j}
+	if j.Cron != "" {
+		c, err := ParseCron(j.Cron)
+		if err != nil {
+			return fmt.Errorf("job %s: %v", j.Name, err)
+		}
+		jb.cron = c
+	} else if j.Interval <= 0 {
+		return fmt.Errorf("job %s: interval or cron is required", j.Name)
+	}
+
+	s.mu.Lock()
+	s.jobs = append(s.jobs, jb)
+	s.mu.Unlock()
+	return nil
+}
+
+// Start 为每个任务启动一个调度协程，ctx 结束后全部退出
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, jb := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, jb)
+	}
+}
+
+// Wait 等待所有调度协程以及正在运行的任务结束
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, jb *job) {
+	defer s.wg.Done()
+
+	next := jb.first(time.Now())
+	for {
+		if next.IsZero() {
+			log.Printf("⚠️ [%s] cron never fires, job stopped", jb.Name)
+			return
+		}
+		log.Printf("⏰ [%s] next run at %s", jb.Name, next.Format("01-02 15:04:05"))
+		if jb.OnScheduled != nil {
+			jb.OnScheduled(next)
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.fire(ctx, jb)
+		next = jb.next(time.Now())
+	}
+}
+
+// fire 在新协程里运行任务；上一次还没跑完就跳过本次
+func (s *Scheduler) fire(ctx context.Context, jb *job) {
+	if !jb.running.CompareAndSwap(false, true) {
+		log.Printf("⏭️ [%s] previous run still in progress, skipping", jb.Name)
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer jb.running.Store(false)
+		jb.Run(ctx)
+	}()
+}
+
+func (jb *job) first(now time.Time) time.Time {
+	if jb.cron != nil {
+		return jb.next(now)
+	}
+	return now.Add(jb.Delay + jb.jitter())
+}
+
+func (jb *job) next(now time.Time) time.Time {
+	if jb.cron != nil {
+		t := jb.cron.Next(now)
+		if t.IsZero() {
+			return t
+		}
+		return t.Add(jb.jitter())
+	}
+	return now.Add(jb.Interval + jb.jitter())
+}
+
+func (jb *job) jitter() time.Duration {
+	if jb.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(jb.Jitter)))
+}
+
+// Sleep 等待 d 或 ctx 结束，返回 false 表示 ctx 已结束，调用方应尽快退出
+func Sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalUploader 把图片写到本地目录，可以配合任意静态文件服务器使用，也方便本地测试
+type LocalUploader struct {
+	dir       string
+	publicURL string
+}
+
+func NewLocalUploader(dir, publicURL string) *LocalUploader {
+	return &LocalUploader{dir: dir, publicURL: publicURL}
+}
+
+func (u *LocalUploader) Name() string { return "local" }
+
+func (u *LocalUploader) Upload(ctx context.Context, obj Object) (Location, error) {
+	// Key 来自 post ID，去掉 .. 避免写到目录外面
+	key := strings.TrimPrefix(filepath.ToSlash(filepath.Clean("/"+obj.Key)), "/")
+	path := filepath.Join(u.dir, filepath.FromSlash(key))
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return Location{}, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, obj.Data, 0o644); err != nil {
+		return Location{}, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return Location{}, err
+	}
+
+	loc := Location{Backend: "local", Ref: key}
+	if u.publicURL != "" {
+		loc.URL = u.publicURL + "/" + uriEncode(key)
+	}
+	return loc, nil
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalUploadRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	u := NewLocalUploader(dir, "https://img.example.com")
+
+	data := []byte("\x89PNG fake")
+	loc, err := u.Upload(context.Background(), Object{Key: "pixiv/123_p0.png", Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Backend != "local" || loc.Ref != "pixiv/123_p0.png" || loc.URL != "https://img.example.com/pixiv/123_p0.png" {
+		t.Fatalf("location = %+v", loc)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(loc.Ref)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(data) {
+		t.Fatalf("stored %q, want %q", got, data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pixiv", "123_p0.png.tmp")); !os.IsNotExist(err) {
+		t.Fatalf("temp file left behind: %v", err)
+	}
+}
+
+// Key 里的 .. 不能写到目录外面
+func TestLocalUploadStaysInDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "images")
+	u := NewLocalUploader(dir, "")
+
+	loc, err := u.Upload(context.Background(), Object{Key: "../../escape.jpg", Data: []byte("x")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Ref != "escape.jpg" || loc.URL != "" {
+		t.Fatalf("location = %+v", loc)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "escape.jpg")); !os.IsNotExist(err) {
+		t.Fatalf("file written outside the upload dir: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// S3Uploader 用 PUT Object 上传到 S3 兼容的对象存储 (Cloudflare R2、MinIO 等)
+// 只用到一个接口，所以直接手写 SigV4 签名，不引入 SDK；统一使用 path-style 地址
+type S3Uploader struct {
+	endpoint  string
+	host      string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	publicURL string
+	client    *resty.Client
+}
+
+func NewS3Uploader(endpoint, region, bucket, accessKey, secretKey, publicURL string) (*S3Uploader, error) {
+	if endpoint == "" || bucket == "" || accessKey == "" || secretKey == "" {
+		return nil, errors.New("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY are required")
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT: %s", endpoint)
+	}
+	if region == "" {
+		region = "auto"
+	}
+
+	client := resty.New()
+	client.SetTimeout(120 * time.Second)
+
+	return &S3Uploader{
+		endpoint:  strings.TrimRight(endpoint, "/"),
+		host:      u.Host,
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		publicURL: publicURL,
+		client:    client,
+	}, nil
+}
+
+func (u *S3Uploader) Name() string { return "s3" }
+
+func (u *S3Uploader) Upload(ctx context.Context, obj Object) (Location, error) {
+	path := "/" + u.bucket + "/" + uriEncode(obj.Key)
+	mimeType := obj.MimeType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	now := time.Now().UTC()
+	payloadHash := sha256Hex(obj.Data)
+	headers := map[string]string{
+		"content-type":         mimeType,
+		"host":                 u.host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           now.Format(amzDateFormat),
+	}
+
+	req := u.client.R().
+		SetContext(ctx).
+		SetHeader("Authorization", u.sign("PUT", path, headers, payloadHash, now)).
+		SetBody(obj.Data)
+	for name, value := range headers {
+		if name != "host" { // Host 由 net/http 根据地址填写
+			req.SetHeader(name, value)
+		}
+	}
+	resp, err := req.Put(u.endpoint + path)
+	if err != nil {
+		return Location{}, err
+	}
+	if resp.StatusCode() != 200 {
+		return Location{}, fmt.Errorf("S3 PUT %s: status %d: %s", obj.Key, resp.StatusCode(), resp.String())
+	}
+
+	loc := Location{Backend: "s3", Ref: obj.Key}
+	if u.publicURL != "" {
+		loc.URL = u.publicURL + "/" + uriEncode(obj.Key)
+	}
+	return loc, nil
+}
+
+const amzDateFormat = "20060102T150405Z"
+
+// sign 按 AWS Signature Version 4 生成 Authorization 头
+// headers 是全部参与签名的头，名字小写，必须包含 host
+func (u *S3Uploader) sign(method, path string, headers map[string]string, payloadHash string, now time.Time) string {
+	canonical, signed := canonicalRequest(method, path, headers, payloadHash)
+	scope := now.Format("20060102") + "/" + u.region + "/s3/aws4_request"
+	sig := signature(u.secretKey, now, u.region, "s3", stringToSign(now, scope, canonical))
+	return fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		u.accessKey, scope, signed, sig)
+}
+
+// canonicalRequest 返回规范请求和 SignedHeaders；只上传对象，没有查询参数
+func canonicalRequest(method, path string, headers map[string]string, payloadHash string) (canonical, signed string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signed = strings.Join(names, ";")
+	canonical = strings.Join([]string{method, path, "", b.String(), signed, payloadHash}, "\n")
+	return canonical, signed
+}
+
+func stringToSign(now time.Time, scope, canonical string) string {
+	return strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format(amzDateFormat),
+		scope,
+		sha256Hex([]byte(canonical)),
+	}, "\n")
+}
+
+// signature 用日期、区域、服务逐层派生签名密钥
+func signature(secretKey string, now time.Time, region, service, toSign string) string {
+	key := hmacSHA256([]byte("AWS4"+secretKey), now.Format("20060102"))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// uriEncode 按 SigV4 的规则编码对象 key，保留 /
+func uriEncode(key string) string {
+	var b strings.Builder
+	for _, c := range []byte(key) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
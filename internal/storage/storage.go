@@ -0,0 +1,89 @@
+// Package storage 定义图片上传后端：Telegram 频道之外，还可以存到 S3 兼容的对象存储 (R2、MinIO) 或本地目录
+package storage
+
+import (
+	"context"
+	"strings"
+)
+
+// Object 是要上传的一张图
+type Object struct {
+	Key      string // 存储路径，如 pixiv/pixiv_123_p0.png
+	Data     []byte
+	MimeType string
+	Caption  string
+	Platform string // 来源平台，Telegram 用它拼文件名
+	Width    int    // 已知的尺寸，可以为 0
+	Height   int
+
+	// Document 是 Telegram 回复在预览图下面的原图文件，一般就是 Data
+	// 原图超过 50MB 时可能是无损重编码后的版本，为 nil 时只发预览图，其它后端不看这个字段
+	Document []byte
+}
+
+// Location 是一张图在某个后端里的位置，一条记录可以有多个
+type Location struct {
+	Backend string `json:"backend"`           // telegram / s3 / local
+	Ref     string `json:"ref"`               // 原图引用：Telegram file_id、对象 key 或相对路径
+	Preview string `json:"preview,omitempty"` // 预览图引用，只有 Telegram 会单独发一张压缩图
+	URL     string `json:"url,omitempty"`     // 可以直接访问的地址，没有配置公开前缀时为空
+}
+
+// GalleryRef 返回写进 images.file_name 的引用
+// Telegram 保持原来的 file_id，其它后端加上 "<backend>:" 前缀，Worker 按前缀决定去哪里取图
+func (l Location) GalleryRef(preview bool) string {
+	if l.Backend == "telegram" {
+		if preview && l.Preview != "" {
+			return l.Preview
+		}
+		return l.Ref
+	}
+	if l.Ref == "" {
+		return ""
+	}
+	return l.Backend + ":" + l.Ref
+}
+
+// Uploader 是一个上传后端
+type Uploader interface {
+	Name() string
+	Upload(ctx context.Context, obj Object) (Location, error)
+}
+
+// Ext 按 MIME 类型返回文件后缀，认不出的按 .jpg 处理
+func Ext(mimeType string) string {
+	switch strings.ToLower(mimeType) {
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "image/avif":
+		return ".avif"
+	case "image/bmp":
+		return ".bmp"
+	default:
+		return ".jpg"
+	}
+}
+
+// BatchUploader 是可以一次上传一组图的后端，比如 Telegram 相册
+type BatchUploader interface {
+	Uploader
+	// UploadBatch 返回与 objs 一一对应的位置和错误
+	UploadBatch(ctx context.Context, objs []Object) ([]Location, []error)
+}
+
+// UploadAll 用 u 上传一组图：实现了 BatchUploader 的后端整组上传，其它的逐张上传
+func UploadAll(ctx context.Context, u Uploader, objs []Object) ([]Location, []error) {
+	if b, ok := u.(BatchUploader); ok && len(objs) > 1 {
+		return b.UploadBatch(ctx, objs)
+	}
+	locs := make([]Location, len(objs))
+	errs := make([]error, len(objs))
+	for i, obj := range objs {
+		locs[i], errs[i] = u.Upload(ctx, obj)
+	}
+	return locs, errs
+}
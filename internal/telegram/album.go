@@ -0,0 +1,64 @@
+package telegram
+
+import (
+	"context"
+
+	"my-bot-go/internal/database"
+)
+
+// maxAlbumSize 是 sendMediaGroup 一次最多能发的图片数
+const maxAlbumSize = 10
+
+// AlbumItem 是相册里的一页
+type AlbumItem struct {
+	Data []byte
+	Rec  database.ImageRecord
+}
+
+// AlbumSize 返回一次最多一起发送的页数，ALBUM_MODE 关闭时为 1
+func (h *BotHandler) AlbumSize() int {
+	if !h.Cfg.AlbumMode {
+		return 1
+	}
+	return maxAlbumSize
+}
+
+// ItemStatus 是一张图的发送结果
+type ItemStatus int
+
+const (
+	ItemUnsent  ItemStatus = iota // 没发出去 (所有上传后端都失败或 ctx 已结束)，下次还要再试
+	ItemSent                      // 上传成功并写库
+	ItemSkipped                   // 已经发过、内容相同或相似
+)
+
+// SendResult 是一次发送里各张图的结果
+type SendResult struct {
+	Sent    int // 上传成功并写库
+	Skipped int // 已经发过、内容相同或相似
+	Failed  int // 所有上传后端都失败
+
+	Items []ItemStatus // 与传入的图一一对应
+}
+
+func (r *SendResult) add(o SendResult) {
+	r.Sent += o.Sent
+	r.Skipped += o.Skipped
+	r.Failed += o.Failed
+	r.Items = append(r.Items, o.Items...)
+}
+
+// ProcessAndSendAlbum 发送一个多页作品：ALBUM_MODE 开启时每 10 页作为一个相册发送，否则逐张发送
+// 每一页各自写库，跳过、查重的规则与 ProcessAndSend 相同，res.Items 是每一页的结果
+func (h *BotHandler) ProcessAndSendAlbum(ctx context.Context, items []AlbumItem) SendResult {
+	var res SendResult
+	size := h.AlbumSize()
+	for start := 0; start < len(items); start += size {
+		end := start + size
+		if end > len(items) {
+			end = len(items)
+		}
+		res.add(h.send(ctx, items[start:end]))
+	}
+	return res
+}
@@ -0,0 +1,150 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"my-bot-go/internal/config"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Role 是用户的权限等级，高等级包含低等级的所有权限
+type Role int
+
+const (
+	RoleNone   Role = iota
+	RoleEditor      // 发图：作品链接、手动转发、/forward_*
+	RoleAdmin       // 管理：/save、/delete、/queue ...
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleAdmin:
+		return "admin"
+	case RoleEditor:
+		return "editor"
+	default:
+		return "none"
+	}
+}
+
+// roles 是 ADMIN_IDS / EDITOR_IDS 的查找表
+type roles map[int64]Role
+
+func newRoles(cfg *config.Config) roles {
+	r := make(roles)
+	for _, id := range cfg.EditorIDs {
+		r[id] = RoleEditor
+	}
+	// 同时出现在两个列表里时按管理员算
+	for _, id := range cfg.AdminIDs {
+		r[id] = RoleAdmin
+	}
+	return r
+}
+
+// RoleOf 返回用户的权限等级，不在列表里的是 RoleNone
+func (h *BotHandler) RoleOf(userID int64) Role {
+	return h.roles[userID]
+}
+
+// requireRole 返回按 role 检查调用者的中间件，command 只用于日志
+// 被拒绝的请求不会进入 next，写一条审计日志；斜杠指令额外回复一句
+func (h *BotHandler) requireRole(role Role, command string) bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			if !h.authorize(ctx, b, update, role, command) {
+				return
+			}
+			next(ctx, b, update)
+		}
+	}
+}
+
+// authorize 检查消息发送者是否至少有 role 的权限，没有时记审计日志并返回 false
+func (h *BotHandler) authorize(ctx context.Context, b *bot.Bot, update *models.Update, role Role, command string) bool {
+	msg := update.Message
+	if msg == nil || msg.From == nil {
+		return false
+	}
+	got := h.RoleOf(msg.From.ID)
+	if got >= role {
+		return true
+	}
+
+	log.Printf("⛔ Unauthorized %s attempt from UserID: %d (@%s, role %s)", command, msg.From.ID, msg.From.Username, got)
+	h.audit.record(auditEntry{
+		Time:     time.Now().Unix(),
+		UserID:   msg.From.ID,
+		Username: msg.From.Username,
+		ChatID:   msg.Chat.ID,
+		Command:  command,
+		Text:     msg.Text,
+		Role:     got.String(),
+		Required: role.String(),
+	})
+
+	if strings.HasPrefix(msg.Text, "/") {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: msg.Chat.ID,
+			Text:   "⛔ 你没有权限执行这个操作喵~",
+		})
+	}
+	return false
+}
+
+// auditEntry 是审计日志里的一行
+type auditEntry struct {
+	Time     int64  `json:"time"`
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username,omitempty"`
+	ChatID   int64  `json:"chat_id"`
+	Command  string `json:"command"`
+	Text     string `json:"text,omitempty"`
+	Role     string `json:"role"`
+	Required string `json:"required"`
+}
+
+// auditLog 把被拒绝的操作追加写到 AUDIT_LOG_PATH，路径为空时只打日志
+type auditLog struct {
+	mu   sync.Mutex
+	path string
+}
+
+func newAuditLog(path string) *auditLog {
+	return &auditLog{path: path}
+}
+
+func (a *auditLog) record(e auditEntry) {
+	if a.path == "" {
+		return
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(a.path), 0o755); err != nil {
+		log.Printf("⚠️ Write audit log failed: %v", err)
+		return
+	}
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Printf("⚠️ Write audit log failed: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Printf("⚠️ Write audit log failed: %v", err)
+	}
+}
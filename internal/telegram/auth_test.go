@@ -0,0 +1,101 @@
+package telegram
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"my-bot-go/internal/config"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func readAudit(t *testing.T, path string) []auditEntry {
+	t.Helper()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var list []auditEntry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e auditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("bad audit line %q: %v", sc.Text(), err)
+		}
+		list = append(list, e)
+	}
+	return list
+}
+
+func TestRequireRole(t *testing.T) {
+	api := newFakeAPI(t)
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	h := newTestHandler(t, api, &config.Config{AdminIDs: []int64{1}, EditorIDs: []int64{2}, AuditLogPath: auditPath})
+
+	var called []int64
+	handler := h.requireRole(RoleAdmin, "/delete")(func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		called = append(called, update.Message.From.ID)
+	})
+	ctx := context.Background()
+	for _, id := range []int64{1, 2, 3} {
+		handler(ctx, h.API, textUpdate(id, "/delete pixiv_1_p0"))
+	}
+
+	if len(called) != 1 || called[0] != 1 {
+		t.Fatalf("handler called for %v, want only the admin", called)
+	}
+
+	entries := readAudit(t, auditPath)
+	if len(entries) != 2 {
+		t.Fatalf("audit log has %d lines, want 2: %+v", len(entries), entries)
+	}
+	want := []auditEntry{
+		{UserID: 2, Username: "user2", ChatID: 2, Command: "/delete", Text: "/delete pixiv_1_p0", Role: "editor", Required: "admin"},
+		{UserID: 3, Username: "user3", ChatID: 3, Command: "/delete", Text: "/delete pixiv_1_p0", Role: "none", Required: "admin"},
+	}
+	for i, e := range entries {
+		if e.Time == 0 {
+			t.Errorf("audit line %d has no time", i)
+		}
+		e.Time = 0
+		if e != want[i] {
+			t.Errorf("audit line %d = %+v, want %+v", i, e, want[i])
+		}
+	}
+
+	replies := api.sent("sendMessage")
+	if len(replies) != 2 || replies[0].Get("chat_id") != "2" || replies[1].Get("chat_id") != "3" {
+		t.Fatalf("denial replies = %v", replies)
+	}
+}
+
+// 不是斜杠指令时只记审计日志，不回复
+func TestAuthorizeUploadSilently(t *testing.T) {
+	api := newFakeAPI(t)
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	h := newTestHandler(t, api, &config.Config{EditorIDs: []int64{2}, AuditLogPath: auditPath})
+
+	ctx := context.Background()
+	if !h.authorize(ctx, h.API, textUpdate(2, "https://www.pixiv.net/artworks/1"), RoleEditor, "pixiv link") {
+		t.Fatal("editor denied a pixiv link")
+	}
+	if h.authorize(ctx, h.API, textUpdate(3, "https://www.pixiv.net/artworks/1"), RoleEditor, "pixiv link") {
+		t.Fatal("stranger allowed to post a pixiv link")
+	}
+
+	if entries := readAudit(t, auditPath); len(entries) != 1 || entries[0].Command != "pixiv link" || entries[0].UserID != 3 {
+		t.Fatalf("audit log = %+v", entries)
+	}
+	if n := len(api.sent("sendMessage")); n != 0 {
+		t.Fatalf("%d replies sent for a non-command message", n)
+	}
+}
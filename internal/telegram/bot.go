@@ -1,11 +1,8 @@
 package telegram
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"image"
-	"image/jpeg"
 	_ "image/png"
 	"io"
 	"log"
@@ -15,64 +12,110 @@ import (
 	"sync"
 	"time"
 
+	"my-bot-go/internal/canonical"
 	"my-bot-go/internal/config"
 	"my-bot-go/internal/database"
+	"my-bot-go/internal/imageprep"
 	"my-bot-go/internal/manyacg"
+	"my-bot-go/internal/metrics"
 	"my-bot-go/internal/pixiv"
+	"my-bot-go/internal/storage"
 	"my-bot-go/internal/yande"
 	// "my-bot-go/internal/fanbox"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
-	"github.com/nfnt/resize"
 )
 
 type BotHandler struct {
-	API             *bot.Bot
-	Cfg             *config.Config
-	DB              *database.D1Client
-	mu              sync.RWMutex // 🔴 新增互斥锁
-	Forwarding      bool
-	ForwardBaseID   string
-	ForwardIndex    int
-	ForwardTitle    string
-	ForwardArtist   string
-	ForwardTags     string
-	CurrentPreview  *models.Message
-	CurrentOriginal *models.Message
+	API *bot.Bot
+	Cfg *config.Config
+	DB  *database.DB
+
+	inflight  sync.WaitGroup     // 正在上传的 ProcessAndSend，关机时等待它们完成
+	sending   *keyLocks          // 正在发送的 post ID，见 send
+	uploaders []storage.Uploader // 按 UPLOAD_BACKENDS 顺序
+	sendQ     *sendQueue         // 发往频道的请求都经过这里排队
+	oversize  storage.Uploader   // 单独存超限原图的后端，可以为 nil，见 oversize.go
+	roles     roles              // ADMIN_IDS / EDITOR_IDS，见 auth.go
+	audit     *auditLog
+	forwards  *forwardSessions  // 进行中的 /forward_start 会话，按 chat + 用户区分，见 forward.go
+	albums    *albumCollector   // 转发会话里收到的相册，见 forward_album.go
+	metrics   *metrics.Registry // 爬虫的运行情况，/status 读取
+	started   time.Time
+	crawler   Crawler    // /crawl 手动运行图源，见 crawl.go
+	crawls    *crawlRuns // 进行中的 /crawl，/cancel 用
 }
 
-func NewBot(cfg *config.Config, db *database.D1Client) (*BotHandler, error) {
-	h := &BotHandler{Cfg: cfg, DB: db}
+func NewBot(cfg *config.Config, db *database.DB, reg *metrics.Registry) (*BotHandler, error) {
+	h := &BotHandler{
+		Cfg:   cfg,
+		DB:    db,
+		sendQ: newSendQueue(cfg.TGRatePerMinute),
+		sending: newKeyLocks(),
+		roles: newRoles(cfg),
+		audit: newAuditLog(cfg.AuditLogPath),
+
+		forwards: newForwardSessions(cfg.ForwardSessionsPath, cfg.ForwardSessionTTL),
+		albums:   newAlbumCollector(),
+		metrics:  reg,
+		started:  time.Now(),
+		crawls:   newCrawlRuns(),
+	}
 
-	b, err := bot.New(cfg.BotToken)
+	var opts []bot.Option
+	if cfg.TGAPIURL != "" {
+		opts = append(opts, bot.WithServerURL(cfg.TGAPIURL))
+	}
+	b, err := bot.New(cfg.BotToken, opts...)
 	if err != nil {
 		return nil, err
 	}
 
 	h.API = b
 
+	h.uploaders, err = newUploaders(cfg, h)
+	if err != nil {
+		return nil, err
+	}
+	h.oversize, err = newOversizeUploader(cfg, h)
+	if err != nil {
+		return nil, err
+	}
+
+	// 每个入口按角色检查调用者，见 auth.go
 	// /save
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/save", bot.MatchTypeExact, h.handleSave)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/save", bot.MatchTypeExact, h.requireRole(RoleAdmin, "/save")(h.handleSave))
 
 	// /delete
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/delete", bot.MatchTypePrefix, h.handleDelete)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/delete", bot.MatchTypePrefix, h.requireRole(RoleAdmin, "/delete")(h.handleDelete))
+
+	// /status 查看爬虫、写库队列和发送限速
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/status", bot.MatchTypeExact, h.requireRole(RoleEditor, "/status")(h.handleStatus))
+
+	// /crawl <图源> [参数] 立刻跑一轮，/cancel 停止
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/crawl", bot.MatchTypePrefix, h.requireRole(RoleAdmin, "/crawl")(h.handleCrawl))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/cancel", bot.MatchTypePrefix, h.requireRole(RoleAdmin, "/cancel")(h.handleCancel))
+
+	// /queue, /queue_flush 查看/重试写库失败的行
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/queue", bot.MatchTypeExact, h.requireRole(RoleAdmin, "/queue")(h.handleQueue))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/queue_flush", bot.MatchTypeExact, h.requireRole(RoleAdmin, "/queue_flush")(h.handleQueueFlush))
 
 	// Pixiv Link
-	b.RegisterHandler(bot.HandlerTypeMessageText, "pixiv.net/artworks/", bot.MatchTypeContains, h.handlePixivLink)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "pixiv.net/artworks/", bot.MatchTypeContains, h.requireRole(RoleEditor, "pixiv link")(h.handlePixivLink))
 
 	// ManyACG Link
-	b.RegisterHandler(bot.HandlerTypeMessageText, "manyacg.top/artwork/", bot.MatchTypeContains, h.handleManyacgLink)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "manyacg.top/artwork/", bot.MatchTypeContains, h.requireRole(RoleEditor, "manyacg link")(h.handleManyacgLink))
 
 	// Yande Link
-	b.RegisterHandler(bot.HandlerTypeMessageText, "yande.re/post/show/", bot.MatchTypeContains, h.handleYandeLink)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "yande.re/post/show/", bot.MatchTypeContains, h.requireRole(RoleEditor, "yande link")(h.handleYandeLink))
 
 	//b.RegisterHandler(bot.HandlerTypeMessageText, "fanbox.cc/@", bot.MatchTypeContains, h.handleFanboxLink)
 
 	// Forward Commands
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/forward_start", bot.MatchTypePrefix, h.handleForwardStart)
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/forward_continue", bot.MatchTypeExact, h.handleForwardContinue)
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/forward_end", bot.MatchTypeExact, h.handleForwardEnd)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/forward_start", bot.MatchTypePrefix, h.requireRole(RoleEditor, "/forward_start")(h.handleForwardStart))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/forward_continue", bot.MatchTypeExact, h.requireRole(RoleEditor, "/forward_continue")(h.handleForwardContinue))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/forward_end", bot.MatchTypeExact, h.requireRole(RoleEditor, "/forward_end")(h.handleForwardEnd))
 
 	// Universal Handler
 	b.RegisterHandler(bot.HandlerTypeMessageText, "", bot.MatchTypePrefix, func(ctx context.Context, b *bot.Bot, update *models.Update) {
@@ -85,58 +128,24 @@ func NewBot(cfg *config.Config, db *database.D1Client) (*BotHandler, error) {
 			return
 		}
 
-		// 加读锁检查状态
-		h.mu.RLock()
-		isForwarding := h.Forwarding
-		h.mu.RUnlock()
+		// 下面只处理图片和文件，普通聊天不检查权限
+		if len(update.Message.Photo) == 0 && update.Message.Document == nil {
+			return
+		}
+		if !h.authorize(ctx, b, update, RoleEditor, "upload") {
+			return
+		}
 
-		// 转发模式，拦截图片
-		if isForwarding {
-			go func() {
-				// 加写锁，因为内部可能修改 CurrentPreview
-				h.mu.Lock()
-				defer h.mu.Unlock()
-
-				// double check
-				if !h.Forwarding {
-					return
-				}
-
-				msg := update.Message
-				bgCtx := context.Background()
-
-				// 处理图片 (Preview)
-				if len(msg.Photo) > 0 {
-					h.CurrentPreview = msg
-					h.CurrentOriginal = nil
-
-					log.Printf("🖼 [Forward] 收到 P%d 预览图", h.ForwardIndex)
-					b.SendMessage(bgCtx, &bot.SendMessageParams{
-						ChatID:          msg.Chat.ID,
-						Text:            fmt.Sprintf("✅ yukiyuki获取到 P%d 预览图啦，主人请发送原图文件(Document)吧，喵~🐱", h.ForwardIndex),
-						ReplyParameters: &models.ReplyParameters{MessageID: msg.ID},
-					})
-					return
-				}
-
-				// 处理文件 (Original)
-				if msg.Document != nil {
-					if h.CurrentPreview == nil {
-						h.CurrentPreview = msg
-						h.CurrentOriginal = msg
-					} else {
-						h.CurrentOriginal = msg
-					}
-
-					log.Printf("📄 [Forward] 收到 P%d 原图", h.ForwardIndex)
-					b.SendMessage(bgCtx, &bot.SendMessageParams{
-						ChatID:          msg.Chat.ID,
-						Text:            fmt.Sprintf("✅ P%d 就绪了喵~🐱。\n请输入 /forward_continue 发布并继续下一张\n或 /forward_end 发布并结束（^v^）。", h.ForwardIndex),
-						ReplyParameters: &models.ReplyParameters{MessageID: msg.ID},
-					})
-					return
-				}
-			}()
+		// 1. 这个用户在这个 chat 里正在转发，图片交给会话处理
+		// 相册 (media_group_id 相同的多条消息) 收齐后整组处理
+		if sess := h.forwards.get(forwardKeyOf(update.Message)); sess != nil {
+			if update.Message.MediaGroupID != "" {
+				h.albums.add(update.Message, func(msgs []*models.Message) {
+					h.handleForwardAlbum(context.Background(), b, sess, msgs)
+				})
+				return
+			}
+			go h.handleForwardMedia(context.Background(), b, sess, update.Message)
 			return
 		}
 
@@ -152,9 +161,25 @@ func NewBot(cfg *config.Config, db *database.D1Client) (*BotHandler, error) {
 }
 
 func (h *BotHandler) Start(ctx context.Context) {
+	go h.runForwardSweeper(ctx)
 	h.API.Start(ctx)
 }
 
+// Wait 等待所有进行中的上传完成，超时返回 false
+func (h *BotHandler) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		h.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
 func (h *BotHandler) downloadFile(ctx context.Context, fileID string) ([]byte, error) {
 	file, err := h.API.GetFile(ctx, &bot.GetFileParams{FileID: fileID})
 	if err != nil {
@@ -169,80 +194,130 @@ func (h *BotHandler) downloadFile(ctx context.Context, fileID string) ([]byte, e
 	return io.ReadAll(resp.Body)
 }
 
-func (h *BotHandler) ProcessAndSend(ctx context.Context, imgData []byte, postID, tags, caption, artist, source string, width, height int) {
-	if h.DB.History[postID] {
-		log.Printf("⏭️ Skip %s: already in history", postID)
+// ProcessAndSend 把一张图上传到所有配置的后端 (默认是发预览图和原图到频道) 并写库
+// rec 里的 FileID/OriginID/Locations/FileSize/MimeType 由这里填写
+func (h *BotHandler) ProcessAndSend(ctx context.Context, imgData []byte, rec database.ImageRecord) {
+	h.send(ctx, []AlbumItem{{Data: imgData, Rec: rec}})
+}
+
+// send 上传一组图并逐条写库，多于一张时支持相册的后端整组发送，返回每张图的结果计数
+func (h *BotHandler) send(ctx context.Context, items []AlbumItem) (res SendResult) {
+	res.Items = make([]ItemStatus, len(items))
+	if ctx.Err() != nil {
 		return
 	}
-	const MaxPhotoSize = 9 * 1024 * 1024
-	shouldCompress := int64(len(imgData)) > MaxPhotoSize || (width > 4950 || height > 4950)
-	finalData := imgData
 
-	if shouldCompress {
-		log.Printf("⚠️ Image %s needs processing (Size: %.2f MB, Dim: %dx%d)...", postID, float64(len(imgData))/1024/1024, width, height)
-		compressed, err := compressImage(imgData, MaxPhotoSize)
-		if err != nil {
-			log.Printf("❌ Compression failed: %v. Trying original...", err)
-		} else {
-			finalData = compressed
-		}
-	}
+	// 已经开始的上传不随 ctx 取消，关机时由 Wait 等它发完并存库
+	h.inflight.Add(1)
+	defer h.inflight.Done()
+	ctx = context.WithoutCancel(ctx)
 
-	params := &bot.SendPhotoParams{
-		ChatID:  h.Cfg.ChannelID,
-		Photo:   &models.InputFileUpload{Filename: source + ".jpg", Data: bytes.NewReader(finalData)},
-		Caption: caption,
+	// 几个爬虫同时遇到同一张图时，后来的等前面的发完，再按历史跳过
+	keys := make([]string, 0, 2*len(items))
+	for _, it := range items {
+		keys = append(keys, it.Rec.PostID, it.Rec.CanonicalID)
 	}
-
-	msg, err := h.API.SendPhoto(ctx, params)
-	if err != nil {
-		log.Printf("❌ Telegram Send Failed [%s]: %v", postID, err)
-		return
+	unlock := h.sending.lock(keys)
+	defer unlock()
+
+	var pending []AlbumItem
+	var pendingIdx []int // pending 在 items 里的下标
+	for i, it := range items {
+		if h.DB.IsSeen(it.Rec.PostID) || (it.Rec.CanonicalID != "" && h.DB.IsSeen(it.Rec.CanonicalID)) {
+			log.Printf("⏭️ Skip %s: already in history", it.Rec.PostID)
+			res.Skipped++
+			res.Items[i] = ItemSkipped
+			continue
+		}
+		// 同一张图从不同来源进来时 ID 不同，先按文件内容查完全相同的，再用感知哈希查相似的
+		if h.checkIdentical(it.Data, &it.Rec) || h.checkSimilar(it.Data, &it.Rec) {
+			res.Skipped++
+			res.Items[i] = ItemSkipped
+			continue
+		}
+		pending = append(pending, it)
+		pendingIdx = append(pendingIdx, i)
 	}
-
-	if len(msg.Photo) == 0 {
+	if len(pending) == 0 {
 		return
 	}
-	fileID := msg.Photo[len(msg.Photo)-1].FileID
-
-	docParams := &bot.SendDocumentParams{
-		ChatID: h.Cfg.ChannelID,
-		Document: &models.InputFileUpload{
-			Filename: source + "_original.jpg",
-			Data:     bytes.NewReader(imgData),
-		},
-		ReplyParameters: &models.ReplyParameters{
-			MessageID: msg.ID,
-		},
-		Caption: "⬇️ Original File",
+
+	objs := make([]storage.Object, len(pending))
+	for i := range pending {
+		rec := &pending[i].Rec
+		rec.MimeType = imageprep.DetectMIME(pending[i].Data)
+		objs[i] = storage.Object{
+			Key:      storageKey(*rec, rec.MimeType),
+			Data:     pending[i].Data,
+			MimeType: rec.MimeType,
+			Caption:  rec.Caption,
+			Platform: rec.Platform,
+			Width:    rec.Width,
+			Height:   rec.Height,
+			Document: pending[i].Data,
+		}
+		// Bot API 发不了 50MB 以上的文件，先试试无损重编码
+		if len(pending[i].Data) > maxDocumentBytes {
+			objs[i].Document = h.oversizeDocument(rec.PostID, pending[i].Data)
+		}
 	}
 
-	var originFileID string
-	msgDoc, errDoc := h.API.SendDocument(ctx, docParams)
-	if errDoc != nil {
-		log.Printf("⚠️ SendDocument Failed (Will only save preview): %v", errDoc)
-		originFileID = ""
-	} else {
-		originFileID = msgDoc.Document.FileID
+	// 按 UPLOAD_BACKENDS 的顺序逐个上传，第一个成功的作为图库默认的引用
+	locations := make([][]storage.Location, len(pending))
+	for _, u := range h.uploaders {
+		locs, errs := storage.UploadAll(ctx, u, objs)
+		for i := range pending {
+			if errs[i] != nil {
+				log.Printf("❌ %s Upload Failed [%s]: %v", u.Name(), pending[i].Rec.PostID, errs[i])
+				continue
+			}
+			locations[i] = append(locations[i], locs[i])
+		}
 	}
 
-	err = h.DB.SaveImage(postID, fileID, originFileID, caption, artist, tags, source, width, height)
-	if err != nil {
-		log.Printf("❌ D1 Save Failed: %v", err)
-	} else {
-		log.Printf("✅ Saved: %s (Preview + Origin)", postID)
+	for i, it := range pending {
+		if len(locations[i]) == 0 {
+			res.Failed++
+			continue
+		}
+		res.Sent++
+		res.Items[pendingIdx[i]] = ItemSent
+		rec := it.Rec
+		// 图已经在频道里了，不等写库就记入历史，写库失败由重试队列负责
+		h.DB.MarkSeen(rec.PostID)
+		if rec.CanonicalID != "" {
+			h.DB.MarkSeen(rec.CanonicalID)
+		}
+		rec.FileID = locations[i][0].GalleryRef(true)
+		rec.OriginID = locations[i][0].GalleryRef(false)
+		rec.Locations = locations[i]
+		rec.FileSize = int64(len(it.Data))
+		if len(it.Data) > maxDocumentBytes && locations[i][0].Backend == "telegram" {
+			if rec.OriginID != "" {
+				rec.OriginalMode = originalReencode
+			} else {
+				h.resolveOversize(ctx, &rec, objs[i])
+			}
+		}
+
+		// 多页作品的每一页攒成一批写库，由爬虫在作品结束时 Flush
+		postID := rec.PostID
+		h.DB.QueueImage(rec, func(err error) {
+			if err != nil {
+				log.Printf("❌ D1 Save Failed [%s], queued for retry: %v", postID, err)
+			} else {
+				log.Printf("✅ Saved: %s (Preview + Origin)", postID)
+			}
+		})
 	}
+	return res
 }
 
 func (h *BotHandler) handleSave(ctx context.Context, b *bot.Bot, update *models.Update) {
 	userID := update.Message.From.ID
-	if userID != 8040798522 && userID != 6874581126 {
-		log.Printf("⛔ Unauthorized /save attempt from UserID: %d", userID)
-		return
-	}
 	log.Printf("💾 Manual save triggered by UserID: %d", userID)
 	if h.DB != nil {
-		h.DB.PushHistory()
+		h.DB.PushHistoryNow()
 		b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: update.Message.Chat.ID,
 			Text:   "✅ History successfully saved to Cloudflare D1!",
@@ -265,10 +340,14 @@ func (h *BotHandler) handleManual(ctx context.Context, b *bot.Bot, update *model
 	if caption == "" {
 		caption = "MtcACG:TG"
 	}
-	msg, err := b.SendPhoto(ctx, &bot.SendPhotoParams{
-		ChatID:  h.Cfg.ChannelID,
-		Photo:   &models.InputFileString{Data: photo.FileID},
-		Caption: caption,
+	var msg *models.Message
+	err := h.sendQ.Do(ctx, h.Cfg.ChannelID, 1, func(ctx context.Context) (err error) {
+		msg, err = b.SendPhoto(ctx, &bot.SendPhotoParams{
+			ChatID:  h.Cfg.ChannelID,
+			Photo:   &models.InputFileString{Data: photo.FileID},
+			Caption: caption,
+		})
+		return err
 	})
 	if err != nil {
 		b.SendMessage(ctx, &bot.SendMessageParams{
@@ -280,7 +359,17 @@ func (h *BotHandler) handleManual(ctx context.Context, b *bot.Bot, update *model
 	finalFileID := msg.Photo[len(msg.Photo)-1].FileID
 	width := photo.Width
 	height := photo.Height
-	h.DB.SaveImage(postID, finalFileID, "", caption, "Forward", "TG-forward", "TG-C", width, height)
+	h.DB.SaveImage(database.ImageRecord{
+		PostID:   postID,
+		FileID:   finalFileID,
+		Caption:  caption,
+		Artist:   "Forward",
+		Tags:     "TG-forward",
+		Width:    width,
+		Height:   height,
+		Platform: "TG-C",
+		MimeType: "image/jpeg",
+	})
 	b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:          update.Message.Chat.ID,
 		Text:            "✅ handleManual Saved to D1!",
@@ -288,279 +377,9 @@ func (h *BotHandler) handleManual(ctx context.Context, b *bot.Bot, update *model
 	})
 }
 
-func (h *BotHandler) handleForwardStart(ctx context.Context, b *bot.Bot, update *models.Update) {
-	go func() {
-		bgCtx := context.Background()
-		msg := update.Message
-		userID := msg.From.ID
-		if userID != 8040798522 && userID != 6874581126 {
-			return
-	}
-		
-	// 新解析逻辑：标题 艺术家 #标签
-    rawText := ""
-    if len(msg.Text) > len("/forward_start") {
-        rawText = strings.TrimSpace(msg.Text[len("/forward_start"):])
-    }
-
-    title := ""
-    artist := ""
-    tags := ""
-
-    // 分割：最多3部分（标题|艺术家|#标签）
-    parts := strings.Fields(rawText)
-    if len(parts) > 0 {
-        title = parts[0]
-    }
-    if len(parts) > 1 {
-        artist = parts[1]
-    }
-    if len(parts) > 2 {
-        // 从第3个开始拼接成标签（支持多词标签）
-        tags = strings.Join(parts[2:], " ")
-    } else {
-          // 兼容旧格式：如果没有艺术家，只有标题#标签
-        firstHashIndex := strings.Index(rawText, "#")
-        if firstHashIndex != -1 {
-            title = strings.TrimSpace(rawText[:firstHashIndex])
-            tags = strings.TrimSpace(rawText[firstHashIndex:])
-        }
-    }
-
-
-		// 初始化状态
-		h.mu.Lock()
-		h.Forwarding = true
-		h.ForwardBaseID = fmt.Sprintf("manual_%d", msg.ID)
-		h.ForwardIndex = 0
-		h.ForwardTitle = title
-		h.ForwardArtist = artist
-		h.ForwardTags = tags
-		h.CurrentPreview = nil
-		h.CurrentOriginal = nil
-		h.mu.Unlock()
-
-		info := fmt.Sprintf("✅ **转发模式已启动**\n🆔 BaseID: `%s`\n📝 标题: %s\n🏷 标签: %s\n\n🐱 请发送 **首张预览图**吧,喵~(^v^)",
-			h.ForwardBaseID, title, tags)
-
-		b.SendMessage(bgCtx, &bot.SendMessageParams{
-			ChatID: msg.Chat.ID,
-			Text:   info,
-		})
-	}()
-}
-
-func (h *BotHandler) publishCurrentItem(ctx context.Context, b *bot.Bot, chatID int64) bool {
-	// 🔴 1. 快速读取所有需要的状态
-	h.mu.RLock()
-	preview := h.CurrentPreview
-	original := h.CurrentOriginal
-	baseID := h.ForwardBaseID
-	index := h.ForwardIndex
-	title := h.ForwardTitle
-	artist := h.ForwardArtist
-	tags := h.ForwardTags
-	h.mu.RUnlock()
-
-	if preview == nil {
-		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: "⚠️ 嗷，出错啦：当前没有等待发布的图片哦，没办法继续了喵~。"})
-		return false
-	}
-
-	postID := fmt.Sprintf("%s_p%d", baseID, index)
-
-	caption := title
-	if caption == "" {
-		caption = "MtcACG:TG"
-	}
-	if artist != "" {
-       caption += fmt.Sprintf("\nArtist: %s", artist)  // 🔴 新增
-    }
-	caption = fmt.Sprintf("%s [P%d]", caption, index+1)
-	if tags != "" {
-		caption = caption + "\n" + tags
-	}
-
-	dbTags := tags
-	if dbTags == "" {
-		dbTags = "TG-Forward"
-	}
-
-	var previewFileID, originFileID string
-	var width, height int
-
-	// 发送预览图
-	if len(preview.Photo) > 0 {
-		srcPhoto := preview.Photo[len(preview.Photo)-1]
-		fwdMsg, err := b.SendPhoto(ctx, &bot.SendPhotoParams{
-			ChatID:  h.Cfg.ChannelID,
-			Photo:   &models.InputFileString{Data: srcPhoto.FileID},
-			Caption: caption,
-		})
-		if err != nil {
-			log.Printf("❌ P%d Preview Send Failed: %v", index, err)
-			return false
-		}
-		previewFileID = fwdMsg.Photo[len(fwdMsg.Photo)-1].FileID
-		width = srcPhoto.Width
-		height = srcPhoto.Height
-
-		if original != nil && original.Document != nil {
-			originFileID = original.Document.FileID
-		}
-	} else if preview.Document != nil {
-		srcDoc := preview.Document
-		fwdMsg, err := b.SendDocument(ctx, &bot.SendDocumentParams{
-			ChatID:   h.Cfg.ChannelID,
-			Document: &models.InputFileString{Data: srcDoc.FileID},
-			Caption:  caption,
-		})
-		if err != nil {
-			log.Printf("❌ P%d Doc Send Failed: %v", index, err)
-			return false
-		}
-		previewFileID = fwdMsg.Document.FileID
-		originFileID = fwdMsg.Document.FileID
-		if fwdMsg.Document.Thumbnail != nil {
-			width = fwdMsg.Document.Thumbnail.Width
-			height = fwdMsg.Document.Thumbnail.Height
-		}
-	}
-
-	// 补发原图
-	if originFileID != "" && originFileID != previewFileID {
-		docMsg, err := b.SendDocument(ctx, &bot.SendDocumentParams{
-			ChatID:   h.Cfg.ChannelID,
-			Document: &models.InputFileString{Data: originFileID},
-			Caption:  fmt.Sprintf("⬇️ %s P%d Original", title, index),
-		})
-		if err == nil {
-			originFileID = docMsg.Document.FileID
-		}
-	}
-
-	// 存入数据库
-	err := h.DB.SaveImage(postID, previewFileID, originFileID, caption, artist, dbTags, "TG-Forward", width, height)
-	if err != nil {
-		log.Printf("❌ P%d DB Save Failed: %v", index, err)
-		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: "❌ 糟了！数据库保存失败，流程暂停。喵呜(^x_x^)"})
-		return false
-	}
-
-	log.Printf("✅ Published: %s", postID)
-	return true
-}
-
-func (h *BotHandler) handleForwardContinue(ctx context.Context, b *bot.Bot, update *models.Update) {
-	go func() {
-		bgCtx := context.Background()
-		h.mu.RLock()
-		if !h.Forwarding {
-			h.mu.RUnlock()
-			return
-		}
-		h.mu.RUnlock()
-		chatID := update.Message.Chat.ID
-
-		success := h.publishCurrentItem(bgCtx, b, chatID)
-		if !success {
-			return
-		}
-
-		h.mu.Lock()
-		prevIndex := h.ForwardIndex
-		h.ForwardIndex++
-		h.CurrentPreview = nil
-		h.CurrentOriginal = nil
-		h.mu.Unlock()
-
-		b.SendMessage(bgCtx, &bot.SendMessageParams{
-			ChatID: chatID,
-			Text:   fmt.Sprintf("✅ **P%d 已发布** (ID: `%s_p%d`)\n⬇️ 正在等待 **P%d** ...", prevIndex, h.ForwardBaseID, prevIndex, h.ForwardIndex),
-		})
-	}()
-}
-
-func (h *BotHandler) handleForwardEnd(ctx context.Context, b *bot.Bot, update *models.Update) {
-	go func() {
-		bgCtx := context.Background()
-		h.mu.RLock()
-		if !h.Forwarding {
-			h.mu.RUnlock()
-			return
-		}
-		h.mu.RUnlock()
-
-		chatID := update.Message.Chat.ID
-
-		if h.CurrentPreview != nil {
-			success := h.publishCurrentItem(bgCtx, b, chatID)
-			if success {
-				h.mu.RLock()
-				idx := h.ForwardIndex
-				h.mu.RUnlock()
-				b.SendMessage(bgCtx, &bot.SendMessageParams{
-					ChatID: chatID,
-					Text:   fmt.Sprintf("✅ **P%d (尾图) 已发布**", idx),
-				})
-			}
-		}
-
-		h.mu.Lock()
-		h.Forwarding = false
-		h.ForwardBaseID = ""
-		h.ForwardIndex = 0
-		h.CurrentPreview = nil
-		h.CurrentOriginal = nil
-		h.ForwardTitle = ""
-		h.ForwardArtist = ""
-		h.ForwardTags = ""
-		h.mu.Unlock()
-
-		b.SendMessage(bgCtx, &bot.SendMessageParams{
-			ChatID:    chatID,
-			Text:      "🏁 🐱好耶（^-^）**任务完成喵~** 🐱",
-			ParseMode: models.ParseModeMarkdown,
-		})
-	}()
-}
-
-func compressImage(data []byte, targetSize int64) ([]byte, error) {
-	img, format, err := image.Decode(bytes.NewReader(data))
-	if err != nil {
-		return nil, fmt.Errorf("decode error: %v", err)
-	}
-	bounds := img.Bounds()
-	width := bounds.Dx()
-	height := bounds.Dy()
-	if width > 4950 || height > 4950 {
-		log.Printf("📏 Resizing image from %dx%d (Too big for TG)", width, height)
-		if width > height {
-			img = resize.Resize(4950, 0, img, resize.Lanczos3)
-		} else {
-			img = resize.Resize(0, 4950, img, resize.Lanczos3)
-		}
-	}
-	log.Printf("📉 Compressing %s image...", format)
-	quality := 100
-	for {
-		buf := new(bytes.Buffer)
-		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: quality})
-		if err != nil {
-			return nil, fmt.Errorf("encode error: %v", err)
-		}
-		compressedData := buf.Bytes()
-		size := int64(len(compressedData))
-		if size <= targetSize || quality <= 50 {
-			log.Printf("✅ Compressed to %.2f MB (Quality: %d)", float64(size)/1024/1024, quality)
-			return compressedData, nil
-		}
-		quality -= 1
-	}
-}
-
 func (h *BotHandler) handlePixivLink(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if h.Forwarding {
+	// 自己正在转发时链接也当作转发内容，不处理
+	if h.forwards.active(forwardKeyOf(update.Message)) {
 		return
 	}
 
@@ -593,6 +412,15 @@ func (h *BotHandler) handlePixivLink(ctx context.Context, b *bot.Bot, update *mo
 		successCount := 0
 		skippedCount := 0
 
+		// 每攒满一组发一次，ALBUM_MODE 开启时一组就是一个相册
+		var album []AlbumItem
+		sendAlbum := func() {
+			if len(album) > 0 {
+				h.ProcessAndSendAlbum(bgCtx, album)
+				album = nil
+			}
+		}
+
 		for i, page := range illust.Pages {
 			imgData, err := pixiv.DownloadImage(page.Urls.Original, h.Cfg.PixivPHPSESSID)
 			if err != nil {
@@ -609,10 +437,25 @@ func (h *BotHandler) handlePixivLink(ctx context.Context, b *bot.Bot, update *mo
 				skippedCount++
 				continue
 			}
-			h.ProcessAndSend(bgCtx, imgData, pid, illust.Tags, caption, illust.Artist, "pixiv", page.Width, page.Height)
+			album = append(album, AlbumItem{Data: imgData, Rec: database.ImageRecord{
+				PostID:    pid,
+				Caption:   caption,
+				Artist:    illust.Artist,
+				Tags:      illust.Tags,
+				Width:     page.Width,
+				Height:    page.Height,
+				Platform:  "pixiv",
+				SourceURL: "https://www.pixiv.net/artworks/" + illust.ID,
+				ArtworkID: illust.ID,
+				PageIndex: i,
+				R18:       illust.R18,
+			}})
 			successCount++
-			time.Sleep(1 * time.Second)
+			if len(album) >= h.AlbumSize() {
+				sendAlbum()
+			}
 		}
+		sendAlbum()
 
 		finalText := fmt.Sprintf("✅ 处理完成了喵~🐱！\n成功发送: %d 张\n跳过重复: %d 张", successCount, skippedCount)
 		b.SendMessage(bgCtx, &bot.SendMessageParams{
@@ -630,7 +473,8 @@ func (h *BotHandler) handlePixivLink(ctx context.Context, b *bot.Bot, update *mo
 }
 
 func (h *BotHandler) handleManyacgLink(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if h.Forwarding {
+	// 自己正在转发时链接也当作转发内容，不处理
+	if h.forwards.active(forwardKeyOf(update.Message)) {
 		return
 	}
 
@@ -663,6 +507,15 @@ func (h *BotHandler) handleManyacgLink(ctx context.Context, b *bot.Bot, update *
 		successCount := 0
 		skippedCount := 0
 
+		// 每攒满一组发一次，ALBUM_MODE 开启时一组就是一个相册
+		var album []AlbumItem
+		sendAlbum := func() {
+			if len(album) > 0 {
+				h.ProcessAndSendAlbum(bgCtx, album)
+				album = nil
+			}
+		}
+
 		for i, pic := range artwork.Pictures {
 			imgData, err := manyacg.DownloadOriginal(bgCtx, pic.ID)
 			if err != nil {
@@ -676,15 +529,33 @@ func (h *BotHandler) handleManyacgLink(ctx context.Context, b *bot.Bot, update *
 				artwork.Artist,
 				manyacg.FormatTags(artwork.Tags))
 
-			if h.DB.CheckExists(pid) {
+			canonicalID := canonical.FromURL(artwork.SourceURL, i)
+			if h.DB.CheckExists(pid) || (canonicalID != "" && h.DB.CheckExists(canonicalID)) {
 				skippedCount++
 				continue
 			}
 
-			h.ProcessAndSend(bgCtx, imgData, pid, manyacg.FormatTags(artwork.Tags), caption, artwork.Artist.Name, "manyacg", pic.Width, pic.Height)
+			album = append(album, AlbumItem{Data: imgData, Rec: database.ImageRecord{
+				PostID:    pid,
+				Caption:   caption,
+				Artist:    artwork.Artist.Name,
+				Tags:      manyacg.FormatTags(artwork.Tags),
+				Width:     pic.Width,
+				Height:    pic.Height,
+				Platform:  "manyacg",
+				SourceURL: artwork.SourceURL,
+				ArtworkID: artwork.ID,
+				PageIndex: i,
+				R18:       artwork.R18,
+
+				CanonicalID: canonicalID,
+			}})
 			successCount++
-			time.Sleep(1 * time.Second)
+			if len(album) >= h.AlbumSize() {
+				sendAlbum()
+			}
 		}
+		sendAlbum()
 
 		finalText := fmt.Sprintf("✅ 处理完成了喵~🐱！\n成功发送: %d 张\n跳过重复: %d 张", successCount, skippedCount)
 		b.SendMessage(bgCtx, &bot.SendMessageParams{
@@ -702,7 +573,8 @@ func (h *BotHandler) handleManyacgLink(ctx context.Context, b *bot.Bot, update *
 }
 
 func (h *BotHandler) handleYandeLink(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if h.Forwarding {
+	// 自己正在转发时链接也当作转发内容，不处理
+	if h.forwards.active(forwardKeyOf(update.Message)) {
 		return
 	}
 
@@ -763,7 +635,18 @@ func (h *BotHandler) handleYandeLink(ctx context.Context, b *bot.Bot, update *mo
 		caption := fmt.Sprintf("Yande: %d\nSize: %dx%d\nTags: #%s",
 			post.ID, post.Width, post.Height, tags)
 
-		h.ProcessAndSend(bgCtx, imgData, pid, post.Tags, caption, "Yande artist", "yande", post.Width, post.Height)
+		h.ProcessAndSend(bgCtx, imgData, database.ImageRecord{
+			PostID:    pid,
+			Caption:   caption,
+			Artist:    "Yande artist",
+			Tags:      post.Tags,
+			Width:     post.Width,
+			Height:    post.Height,
+			Platform:  "yande",
+			SourceURL: "https://yande.re/post/show/" + postID,
+			ArtworkID: postID,
+			R18:       post.Rating == "e",
+		})
 
 		if loadingMsg != nil {
 			b.DeleteMessage(bgCtx, &bot.DeleteMessageParams{
@@ -784,15 +667,6 @@ func (h *BotHandler) handleDelete(ctx context.Context, b *bot.Bot, update *model
 	go func() {
 		bgCtx := context.Background()
 
-		userID := update.Message.From.ID
-		if userID != 8040798522 && userID != 6874581126 {
-			b.SendMessage(bgCtx, &bot.SendMessageParams{
-				ChatID: update.Message.Chat.ID,
-				Text:   "⛔ 你没有权限执行删除操作喵~",
-			})
-			return
-		}
-
 		text := update.Message.Text
 		parts := strings.Fields(text)
 		if len(parts) < 2 {
@@ -0,0 +1,150 @@
+package telegram
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"my-bot-go/internal/config"
+	"my-bot-go/internal/database"
+	"my-bot-go/internal/metrics"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// fakeAPI 是假的 Bot API 服务器，记下每次调用的方法和参数
+type fakeAPI struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	nextID int
+	calls  []apiCall
+}
+
+type apiCall struct {
+	Method string
+	Form   url.Values
+}
+
+func newFakeAPI(t *testing.T) *fakeAPI {
+	f := &fakeAPI{}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeAPI) handle(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseMultipartForm(32 << 20)
+	method := path.Base(r.URL.Path)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	id := f.nextID
+	if method != "getMe" {
+		f.calls = append(f.calls, apiCall{Method: method, Form: r.Form})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch method {
+	case "getMe":
+		fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"test","username":"test_bot"}}`)
+	case "sendPhoto":
+		fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d,"date":0,"chat":{"id":-100,"type":"channel"},"photo":[{"file_id":"photo_%d","file_unique_id":"p%d","width":8,"height":8}]}}`, id, id, id)
+	case "sendDocument":
+		fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d,"date":0,"chat":{"id":-100,"type":"channel"},"document":{"file_id":"doc_%d","file_unique_id":"d%d"}}}`, id, id, id)
+	case "sendMessage":
+		fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d,"date":0,"chat":{"id":%s,"type":"private"},"text":"ok"}}`, id, r.FormValue("chat_id"))
+	default:
+		fmt.Fprint(w, `{"ok":true,"result":true}`)
+	}
+}
+
+// sent 返回某个方法的所有调用
+func (f *fakeAPI) sent(method string) []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var list []url.Values
+	for _, c := range f.calls {
+		if c.Method == method {
+			list = append(list, c.Form)
+		}
+	}
+	return list
+}
+
+// count 返回 getMe 以外的调用次数
+func (f *fakeAPI) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.calls)
+}
+
+// newTestHandler 返回连着 fakeAPI、写本地 SQLite 的 BotHandler；cfg 里没填的路径都放进测试的临时目录
+func newTestHandler(t *testing.T, api *fakeAPI, cfg *config.Config) *BotHandler {
+	t.Helper()
+	dir := t.TempDir()
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	cfg.BotToken = "1:test"
+	cfg.TGAPIURL = api.URL
+	cfg.ChannelID = -100
+	cfg.StoreBackend = "sqlite"
+	if cfg.SQLitePath == "" {
+		cfg.SQLitePath = filepath.Join(dir, "images.db")
+	}
+	if cfg.WriteQueuePath == "" {
+		cfg.WriteQueuePath = filepath.Join(dir, "pending.jsonl")
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 1
+	}
+	if len(cfg.UploadBackends) == 0 {
+		cfg.UploadBackends = []string{"telegram"}
+	}
+	cfg.TGRatePerMinute = 60000
+
+	db, err := database.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	h, err := NewBot(cfg, db, metrics.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// textUpdate 是 userID 在私聊里发的一条文字消息
+func textUpdate(userID int64, text string) *models.Update {
+	return &models.Update{Message: &models.Message{
+		ID:   1,
+		From: &models.User{ID: userID, Username: fmt.Sprintf("user%d", userID)},
+		Chat: models.Chat{ID: userID, Type: "private"},
+		Text: text,
+	}}
+}
+
+// testPNG 生成一张 8x8 的纯色小图
+func testPNG(c color.RGBA) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for x := 0; x < 8; x++ {
+		for y := 0; y < 8; y++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, img)
+	return buf.Bytes()
+}
@@ -0,0 +1,20 @@
+package telegram
+
+import (
+	"strings"
+	"unicode"
+)
+
+// splitCommand 把 "/crawl@MyBot yande rating:s" 拆成指令 "/crawl" 和剩下的参数
+// 群里点指令菜单时 Telegram 会在指令后面带上 @机器人用户名，比较指令之前要先去掉
+func splitCommand(text string) (cmd, rest string) {
+	text = strings.TrimSpace(text)
+	cmd = text
+	if i := strings.IndexFunc(text, unicode.IsSpace); i >= 0 {
+		cmd, rest = text[:i], strings.TrimSpace(text[i:])
+	}
+	if i := strings.Index(cmd, "@"); i >= 0 {
+		cmd = cmd[:i]
+	}
+	return cmd, rest
+}
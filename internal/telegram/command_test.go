@@ -0,0 +1,76 @@
+package telegram
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"my-bot-go/internal/metrics"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		text, cmd, rest string
+	}{
+		{"/crawl yande rating:s", "/crawl", "yande rating:s"},
+		{"/crawl@MtcACG_bot yande rating:s", "/crawl", "yande rating:s"},
+		{"/cancel@MtcACG_bot", "/cancel", ""},
+		{"  /cancel  ", "/cancel", ""},
+		{"/forward_start@MtcACG_bot 标题\n作者 #tag", "/forward_start", "标题\n作者 #tag"},
+		{"/crawler yande", "/crawler", "yande"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		cmd, rest := splitCommand(tt.text)
+		if cmd != tt.cmd || rest != tt.rest {
+			t.Errorf("splitCommand(%q) = %q, %q; want %q, %q", tt.text, cmd, rest, tt.cmd, tt.rest)
+		}
+	}
+}
+
+// blockingCrawler 把收到的参数发到 started，然后等到被取消
+type blockingCrawler struct {
+	started chan []string
+	stopped chan struct{}
+}
+
+func (c *blockingCrawler) Sources() []string { return []string{"yande"} }
+
+func (c *blockingCrawler) Crawl(ctx context.Context, name string, args []string, stats *metrics.Source) error {
+	c.started <- append([]string{name}, args...)
+	<-ctx.Done()
+	close(c.stopped)
+	return nil
+}
+
+// 群里的指令带着 @机器人用户名，/crawl 和 /cancel 都要认得
+func TestCrawlCommandWithBotName(t *testing.T) {
+	api := newFakeAPI(t)
+	h := newTestHandler(t, api, nil)
+	c := &blockingCrawler{started: make(chan []string, 1), stopped: make(chan struct{})}
+	h.SetCrawler(c)
+	ctx := context.Background()
+
+	h.handleCrawl(ctx, h.API, textUpdate(1, "/crawler yande"))
+	if replies := api.sent("sendMessage"); len(replies) != 1 || !strings.Contains(replies[0].Get("text"), "格式不对") {
+		t.Fatalf("/crawler replies = %v", replies)
+	}
+
+	h.handleCrawl(ctx, h.API, textUpdate(1, "/crawl@test_bot yande rating:s"))
+	select {
+	case got := <-c.started:
+		if strings.Join(got, " ") != "yande rating:s" {
+			t.Fatalf("Crawl got %v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("/crawl@test_bot did not start a run")
+	}
+
+	h.handleCancel(ctx, h.API, textUpdate(1, "/cancel@test_bot yande"))
+	select {
+	case <-c.stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("/cancel@test_bot did not stop the run")
+	}
+}
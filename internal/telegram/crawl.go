@@ -0,0 +1,205 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"my-bot-go/internal/metrics"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// crawlProgressInterval 是 /crawl 刷新进度消息的间隔
+const crawlProgressInterval = 5 * time.Second
+
+// Crawler 按需跑一轮图源，由 crawler 包实现 (crawler 依赖 telegram，这边只能用接口)
+type Crawler interface {
+	Sources() []string
+	// Crawl 跑完一轮才返回，没能开始 (图源不存在、参数不对、正在运行) 时返回错误
+	Crawl(ctx context.Context, name string, args []string, stats *metrics.Source) error
+}
+
+// SetCrawler 启用 /crawl，不设置时 /crawl 只回复用法
+func (h *BotHandler) SetCrawler(c Crawler) {
+	h.crawler = c
+}
+
+// crawlRuns 是进行中的 /crawl，按图源名字区分，/cancel 用
+type crawlRuns struct {
+	mu   sync.Mutex
+	runs map[string]*crawlRun
+}
+
+type crawlRun struct {
+	chatID int64
+	cancel context.CancelFunc
+}
+
+func newCrawlRuns() *crawlRuns {
+	return &crawlRuns{runs: make(map[string]*crawlRun)}
+}
+
+// start 登记一次运行，同一个图源已经有 /crawl 在跑时返回 false
+func (r *crawlRuns) start(name string, chatID int64, cancel context.CancelFunc) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.runs[name] != nil {
+		return false
+	}
+	r.runs[name] = &crawlRun{chatID: chatID, cancel: cancel}
+	return true
+}
+
+func (r *crawlRuns) finish(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.runs, name)
+}
+
+// cancel 取消 name 的运行，name 为空时取消 chatID 里发起的所有运行，返回被取消的图源
+func (r *crawlRuns) cancel(chatID int64, name string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var names []string
+	for n, run := range r.runs {
+		if n == name || (name == "" && run.chatID == chatID) {
+			run.cancel()
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// handleCrawl 处理 /crawl <图源> [参数]，立刻跑一轮并在一条消息里更新进度
+func (h *BotHandler) handleCrawl(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	cmd, rest := splitCommand(update.Message.Text)
+	parts := strings.Fields(rest)
+	if h.crawler == nil || len(parts) < 1 || cmd != "/crawl" {
+		text := "⚠️ 格式不对喵🐱！~请输入：/crawl <图源> [参数]\n例如：/crawl yande rating:s order:score、/crawl pixiv 12345"
+		if h.crawler != nil {
+			text += "\n可用图源：" + strings.Join(h.crawler.Sources(), ", ")
+		}
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: text})
+		return
+	}
+	name, args := parts[0], parts[1:]
+
+	// ctx 在关机时取消，正在上传的图由 send 负责发完
+	runCtx, cancel := context.WithCancel(ctx)
+	if !h.crawls.start(name, chatID, cancel) {
+		cancel()
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   fmt.Sprintf("⏳ %s 已经在跑了，可以用 /cancel %s 停止", name, name),
+		})
+		return
+	}
+
+	msg, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:          chatID,
+		Text:            fmt.Sprintf("🔄 %s 准备开始...", name),
+		ReplyParameters: &models.ReplyParameters{MessageID: update.Message.ID},
+	})
+	if err != nil {
+		log.Printf("⚠️ /crawl status message failed: %v", err)
+		h.crawls.finish(name)
+		cancel()
+		return
+	}
+
+	log.Printf("🕹 /crawl %s %v by UserID: %d", name, args, update.Message.From.ID)
+	go h.runCrawl(runCtx, cancel, b, chatID, msg.ID, name, args)
+}
+
+func (h *BotHandler) runCrawl(ctx context.Context, cancel context.CancelFunc, b *bot.Bot, chatID int64, messageID int, name string, args []string) {
+	defer cancel()
+	defer h.crawls.finish(name)
+
+	// 和定时任务记在同一个统计里，/status 也能看到手动运行
+	stats := h.metrics.Source(name)
+	done := make(chan error, 1)
+	go func() {
+		done <- h.crawler.Crawl(ctx, name, args, stats)
+	}()
+
+	last := ""
+	edit := func(text string) {
+		// 内容没变时 Telegram 会报错，跳过
+		if text == last {
+			return
+		}
+		last = text
+		if _, err := b.EditMessageText(context.Background(), &bot.EditMessageTextParams{
+			ChatID:    chatID,
+			MessageID: messageID,
+			Text:      text,
+		}); err != nil {
+			log.Printf("⚠️ /crawl progress update failed: %v", err)
+		}
+	}
+
+	ticker := time.NewTicker(crawlProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			switch {
+			case err != nil:
+				edit(fmt.Sprintf("❌ %s 没有运行：%v", name, err))
+			case ctx.Err() != nil:
+				edit(crawlText(fmt.Sprintf("🛑 %s 已取消", name), stats.Stats(), time.Now()))
+			default:
+				edit(crawlText(fmt.Sprintf("✅ %s 跑完了", name), stats.Stats(), time.Now()))
+			}
+			return
+		case now := <-ticker.C:
+			edit(crawlText(fmt.Sprintf("🔄 %s 运行中...", name), stats.Stats(), now))
+		}
+	}
+}
+
+// crawlText 是 /crawl 进度消息的内容
+func crawlText(title string, st metrics.SourceStats, now time.Time) string {
+	var sb strings.Builder
+	sb.WriteString(title + "\n")
+	if !st.LastStart.IsZero() {
+		end := st.LastEnd
+		if st.Running || end.IsZero() {
+			end = now
+		}
+		fmt.Fprintf(&sb, "🕒 用时 %s\n", end.Sub(st.LastStart).Round(time.Second))
+	}
+	fmt.Fprintf(&sb, "作品 %d · 发送 %d · 跳过 %d · 失败 %d", st.Found, st.Sent, st.Skipped, st.Failed)
+	if st.LastError != "" {
+		fmt.Fprintf(&sb, "\n⚠️ %s", st.LastError)
+	}
+	return sb.String()
+}
+
+// handleCancel 处理 /cancel [图源]，不带图源时停止这个 chat 里发起的所有 /crawl
+// 已经开始上传的那组图会发完再停
+func (h *BotHandler) handleCancel(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	cmd, rest := splitCommand(update.Message.Text)
+	if cmd != "/cancel" {
+		return
+	}
+	name := ""
+	if parts := strings.Fields(rest); len(parts) > 0 {
+		name = parts[0]
+	}
+
+	text := "🤔 没有正在运行的 /crawl 喵~"
+	if names := h.crawls.cancel(chatID, name); len(names) > 0 {
+		text = fmt.Sprintf("🛑 正在停止 %s，当前这组图发完就结束", strings.Join(names, ", "))
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: text})
+}
@@ -0,0 +1,81 @@
+package telegram
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+
+	"my-bot-go/internal/database"
+	"my-bot-go/internal/imagehash"
+)
+
+// checkIdentical 计算 SHA-256 并写入 rec.SHA256；已经上传过一模一样的文件时直接复用它的 file_id 并返回 true
+func (h *BotHandler) checkIdentical(imgData []byte, rec *database.ImageRecord) bool {
+	sum := sha256.Sum256(imgData)
+	rec.SHA256 = hex.EncodeToString(sum[:])
+
+	existing, err := h.DB.FindByContent(rec.SHA256)
+	if err != nil {
+		log.Printf("⚠️ Content lookup failed [%s]: %v", rec.PostID, err)
+		return false
+	}
+	if existing == nil || existing.PostID == rec.PostID || existing.FileID == "" {
+		return false
+	}
+
+	log.Printf("🧬 %s is identical to %s, reusing its file_id", rec.PostID, existing.PostID)
+	h.reuseUpload(rec, existing)
+	return true
+}
+
+// checkSimilar 计算感知哈希并写入 rec.PHash；发现相似的已有图片时按 PHASH_ACTION 处理并返回 true
+// 去重关闭时也照样记录哈希，以后打开时旧图也能参与比较
+func (h *BotHandler) checkSimilar(imgData []byte, rec *database.ImageRecord) bool {
+	hash, err := imagehash.FromBytes(imgData)
+	if err != nil {
+		log.Printf("⚠️ pHash failed [%s]: %v", rec.PostID, err)
+		return false
+	}
+	rec.PHash = imagehash.Format(hash)
+
+	matchID, dist, ok := h.DB.FindSimilar(hash, rec.ArtworkKey())
+	if !ok || matchID == rec.PostID {
+		return false
+	}
+
+	if h.Cfg.PHashAction == "link" && h.linkExisting(rec, matchID) {
+		log.Printf("🔗 %s looks like %s (distance %d), linked without uploading", rec.PostID, matchID, dist)
+		return true
+	}
+
+	log.Printf("🪞 Skip %s: looks like %s (distance %d)", rec.PostID, matchID, dist)
+	h.DB.MarkSeen(rec.PostID)
+	return true
+}
+
+// linkExisting 复用已有记录的 file_id 为 rec 存一条新记录，已有记录还没落库时返回 false
+func (h *BotHandler) linkExisting(rec *database.ImageRecord, matchID string) bool {
+	existing, err := h.DB.GetImage(matchID)
+	if err != nil || existing == nil || existing.FileID == "" {
+		return false
+	}
+
+	h.reuseUpload(rec, existing)
+	return true
+}
+
+// reuseUpload 不上传，直接用 existing 的 Telegram 文件为 rec 存一条新记录
+func (h *BotHandler) reuseUpload(rec *database.ImageRecord, existing *database.ImageRecord) {
+	rec.FileID = existing.FileID
+	rec.OriginID = existing.OriginID
+	rec.FileSize = existing.FileSize
+	rec.MimeType = existing.MimeType
+	rec.Locations = existing.Locations
+	rec.OriginalMode = existing.OriginalMode
+	postID := rec.PostID
+	h.DB.QueueImage(*rec, func(err error) {
+		if err != nil {
+			log.Printf("❌ D1 Save Failed [%s], queued for retry: %v", postID, err)
+		}
+	})
+}
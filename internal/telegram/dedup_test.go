@@ -0,0 +1,60 @@
+package telegram
+
+import (
+	"context"
+	"image/color"
+	"testing"
+
+	"my-bot-go/internal/database"
+)
+
+// 一模一样的文件换了个 ID 再进来：不再上传，复用已有的 file_id 存一条新记录，原站 ID 记成别名
+func TestIdenticalUploadReusesRecord(t *testing.T) {
+	api := newFakeAPI(t)
+	h := newTestHandler(t, api, nil)
+	ctx := context.Background()
+	data := testPNG(color.RGBA{R: 200, G: 10, B: 10, A: 255})
+
+	h.ProcessAndSend(ctx, data, database.ImageRecord{PostID: "pixiv_1_p0", Caption: "pixiv_1_p0", Platform: "pixiv"})
+	h.DB.Flush()
+	if n := len(api.sent("sendPhoto")); n != 1 {
+		t.Fatalf("first send made %d sendPhoto calls", n)
+	}
+	calls := api.count()
+	first, err := h.DB.GetImage("pixiv_1_p0")
+	if err != nil || first == nil || first.FileID == "" {
+		t.Fatalf("first record = %+v, %v", first, err)
+	}
+
+	res := h.ProcessAndSendAlbum(ctx, []AlbumItem{{
+		Data: data,
+		Rec:  database.ImageRecord{PostID: "mtcacg_9", Caption: "mtcacg_9", Platform: "mtcacg", CanonicalID: "pixiv_2_p0"},
+	}})
+	h.DB.Flush()
+
+	if res.Sent != 0 || res.Skipped != 1 || res.Items[0] != ItemSkipped {
+		t.Fatalf("second send result = %+v", res)
+	}
+	if n := api.count(); n != calls {
+		t.Fatalf("identical file uploaded again: %d more Bot API calls", n-calls)
+	}
+
+	reused, err := h.DB.GetImage("mtcacg_9")
+	if err != nil || reused == nil {
+		t.Fatalf("reused record = %+v, %v", reused, err)
+	}
+	if reused.FileID != first.FileID || reused.OriginID != first.OriginID || reused.SHA256 != first.SHA256 {
+		t.Fatalf("reused record = %+v, want the file of %+v", reused, first)
+	}
+
+	// markSaved 把新 ID 和原站 ID 都记进历史，image_aliases 里有 pixiv_2_p0 -> mtcacg_9
+	for _, id := range []string{"mtcacg_9", "pixiv_2_p0"} {
+		if !h.DB.IsSeen(id) {
+			t.Errorf("%s not in history", id)
+		}
+	}
+	h.DB.Forget("pixiv_2_p0")
+	if !h.DB.CheckExists("pixiv_2_p0") {
+		t.Error("alias pixiv_2_p0 not stored in image_aliases")
+	}
+}
@@ -0,0 +1,531 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"my-bot-go/internal/database"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// forwardState 是转发会话的状态
+type forwardState string
+
+const (
+	forwardWaitPreview  forwardState = "wait_preview"  // 等这一页的预览图
+	forwardWaitOriginal forwardState = "wait_original" // 有预览图了，等原图文件 (也可以直接发布)
+	forwardReady        forwardState = "ready"         // 预览和原图都齐了
+
+	forwardAlbumWaitOriginal forwardState = "album_wait_original" // 收到了预览图相册，等原图文件相册 (也可以直接发布)
+)
+
+// forwardFile 是会话里收到的一张图或一个文件
+type forwardFile struct {
+	FileID string `json:"file_id"`
+	Photo  bool   `json:"photo"` // false 表示是文件 (Document)
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// forwardPage 是要发布的一页：预览图 + 原图文件，只有文件时两者相同，只有预览图时 Original 为 nil
+type forwardPage struct {
+	Preview  *forwardFile
+	Original *forwardFile
+}
+
+// forwardKey 按 chat + 用户区分会话，两个管理员可以同时在各自的会话里转发
+type forwardKey struct {
+	ChatID int64 `json:"chat_id"`
+	UserID int64 `json:"user_id"`
+}
+
+// forwardSession 是一次 /forward_start ... /forward_end
+type forwardSession struct {
+	forwardKey
+	BaseID    string        `json:"base_id"`
+	Index     int           `json:"index"`
+	Title     string        `json:"title"`
+	Artist    string        `json:"artist"`
+	Tags      string        `json:"tags"`
+	State     forwardState  `json:"state"`
+	Preview   *forwardFile  `json:"preview,omitempty"`
+	Original  *forwardFile  `json:"original,omitempty"`
+	Album     []forwardFile `json:"album,omitempty"` // 等着和原图相册配对的预览图
+	UpdatedAt time.Time     `json:"updated_at"`
+
+	busy sync.Mutex // 同一个会话的消息逐条处理，发布时收到的图等发布完再处理
+}
+
+// forwardSessions 管理所有进行中的转发会话，每次变化都写到 path，重启后继续
+type forwardSessions struct {
+	mu       sync.Mutex
+	path     string
+	ttl      time.Duration
+	sessions map[forwardKey]*forwardSession
+}
+
+func newForwardSessions(path string, ttl time.Duration) *forwardSessions {
+	s := &forwardSessions{path: path, ttl: ttl, sessions: make(map[forwardKey]*forwardSession)}
+	s.load()
+	return s
+}
+
+func (s *forwardSessions) load() {
+	if s.path == "" {
+		return
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("⚠️ Load forward sessions failed: %v", err)
+		}
+		return
+	}
+	var list []*forwardSession
+	if err := json.Unmarshal(data, &list); err != nil {
+		log.Printf("⚠️ Load forward sessions failed: %v", err)
+		return
+	}
+	for _, sess := range list {
+		s.sessions[sess.forwardKey] = sess
+	}
+	if len(list) > 0 {
+		log.Printf("📂 Restored %d forward session(s)", len(list))
+	}
+}
+
+// save 把所有会话写到文件，调用方持有 s.mu
+func (s *forwardSessions) save() {
+	if s.path == "" {
+		return
+	}
+	list := make([]*forwardSession, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		list = append(list, sess)
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		log.Printf("⚠️ Save forward sessions failed: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		log.Printf("⚠️ Save forward sessions failed: %v", err)
+		return
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		log.Printf("⚠️ Save forward sessions failed: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		log.Printf("⚠️ Save forward sessions failed: %v", err)
+	}
+}
+
+// get 返回 key 对应的会话，没有或已经超时时返回 nil
+func (s *forwardSessions) get(key forwardKey) *forwardSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := s.sessions[key]
+	if sess == nil || s.expired(sess, time.Now()) {
+		return nil
+	}
+	return sess
+}
+
+// active 表示这个用户在这个 chat 里正在转发
+func (s *forwardSessions) active(key forwardKey) bool {
+	return s.get(key) != nil
+}
+
+// begin 开始一个新会话，替换同一个用户在这个 chat 里没结束的旧会话
+func (s *forwardSessions) begin(sess *forwardSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess.State = forwardWaitPreview
+	sess.UpdatedAt = time.Now()
+	s.sessions[sess.forwardKey] = sess
+	s.save()
+}
+
+// update 在锁内修改会话并落盘
+func (s *forwardSessions) update(sess *forwardSession, fn func(sess *forwardSession)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(sess)
+	sess.UpdatedAt = time.Now()
+	s.save()
+}
+
+// end 删除会话
+func (s *forwardSessions) end(key forwardKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, key)
+	s.save()
+}
+
+func (s *forwardSessions) expired(sess *forwardSession, now time.Time) bool {
+	return s.ttl > 0 && now.Sub(sess.UpdatedAt) > s.ttl
+}
+
+// sweep 删除超时的会话并返回它们，正在发布的会话跳过
+func (s *forwardSessions) sweep(now time.Time) []*forwardSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired []*forwardSession
+	for key, sess := range s.sessions {
+		if !s.expired(sess, now) || !sess.busy.TryLock() {
+			continue
+		}
+		sess.busy.Unlock()
+		delete(s.sessions, key)
+		expired = append(expired, sess)
+	}
+	if len(expired) > 0 {
+		s.save()
+	}
+	return expired
+}
+
+// runForwardSweeper 每分钟清理一次超时的转发会话，并通知对应的 chat
+func (h *BotHandler) runForwardSweeper(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, sess := range h.forwards.sweep(now) {
+				log.Printf("⌛ Forward session %s expired (chat %d, user %d)", sess.BaseID, sess.ChatID, sess.UserID)
+				h.API.SendMessage(ctx, &bot.SendMessageParams{
+					ChatID: sess.ChatID,
+					Text:   fmt.Sprintf("⌛ 转发会话 %s 太久没动静，已经自动结束了喵~ 未发布的 P%d 已丢弃。", sess.BaseID, sess.Index),
+				})
+			}
+		}
+	}
+}
+
+func forwardKeyOf(msg *models.Message) forwardKey {
+	key := forwardKey{ChatID: msg.Chat.ID}
+	if msg.From != nil {
+		key.UserID = msg.From.ID
+	}
+	return key
+}
+
+func (h *BotHandler) handleForwardStart(ctx context.Context, b *bot.Bot, update *models.Update) {
+	go func() {
+		bgCtx := context.Background()
+		msg := update.Message
+
+		// 新解析逻辑：标题 艺术家 #标签
+		_, rawText := splitCommand(msg.Text)
+
+		title := ""
+		artist := ""
+		tags := ""
+
+		// 分割：最多3部分（标题|艺术家|#标签）
+		parts := strings.Fields(rawText)
+		if len(parts) > 0 {
+			title = parts[0]
+		}
+		if len(parts) > 1 {
+			artist = parts[1]
+		}
+		if len(parts) > 2 {
+			// 从第3个开始拼接成标签（支持多词标签）
+			tags = strings.Join(parts[2:], " ")
+		} else {
+			// 兼容旧格式：如果没有艺术家，只有标题#标签
+			firstHashIndex := strings.Index(rawText, "#")
+			if firstHashIndex != -1 {
+				title = strings.TrimSpace(rawText[:firstHashIndex])
+				tags = strings.TrimSpace(rawText[firstHashIndex:])
+			}
+		}
+
+		sess := &forwardSession{
+			forwardKey: forwardKeyOf(msg),
+			BaseID:     fmt.Sprintf("manual_%d", msg.ID),
+			Title:      title,
+			Artist:     artist,
+			Tags:       tags,
+		}
+		h.forwards.begin(sess)
+
+		info := fmt.Sprintf("✅ **转发模式已启动**\n🆔 BaseID: `%s`\n📝 标题: %s\n🏷 标签: %s\n\n🐱 请发送 **首张预览图**吧,喵~(^v^)",
+			sess.BaseID, title, tags)
+
+		b.SendMessage(bgCtx, &bot.SendMessageParams{
+			ChatID: msg.Chat.ID,
+			Text:   info,
+		})
+	}()
+}
+
+// handleForwardMedia 处理转发会话里收到的预览图或原图文件
+func (h *BotHandler) handleForwardMedia(ctx context.Context, b *bot.Bot, sess *forwardSession, msg *models.Message) {
+	sess.busy.Lock()
+	defer sess.busy.Unlock()
+	if h.forwards.get(sess.forwardKey) != sess {
+		// 等锁的时候会话已经结束
+		return
+	}
+
+	// 处理图片 (Preview)
+	if len(msg.Photo) > 0 {
+		photo := msg.Photo[len(msg.Photo)-1]
+		h.forwards.update(sess, func(sess *forwardSession) {
+			sess.Preview = &forwardFile{FileID: photo.FileID, Photo: true, Width: photo.Width, Height: photo.Height}
+			sess.Original = nil
+			sess.State = forwardWaitOriginal
+		})
+
+		log.Printf("🖼 [Forward] 收到 P%d 预览图", sess.Index)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          msg.Chat.ID,
+			Text:            fmt.Sprintf("✅ yukiyuki获取到 P%d 预览图啦，主人请发送原图文件(Document)吧，喵~🐱", sess.Index),
+			ReplyParameters: &models.ReplyParameters{MessageID: msg.ID},
+		})
+		return
+	}
+
+	// 处理文件 (Original)，没有预览图时文件同时当预览
+	if msg.Document != nil {
+		doc := &forwardFile{FileID: msg.Document.FileID}
+		h.forwards.update(sess, func(sess *forwardSession) {
+			if sess.Preview == nil || !sess.Preview.Photo {
+				sess.Preview = doc
+			}
+			sess.Original = doc
+			sess.State = forwardReady
+		})
+
+		log.Printf("📄 [Forward] 收到 P%d 原图", sess.Index)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          msg.Chat.ID,
+			Text:            fmt.Sprintf("✅ P%d 就绪了喵~🐱。\n请输入 /forward_continue 发布并继续下一张\n或 /forward_end 发布并结束（^v^）。", sess.Index),
+			ReplyParameters: &models.ReplyParameters{MessageID: msg.ID},
+		})
+	}
+}
+
+// publishCurrentItem 把会话当前这一页发到频道并存库，调用方持有 sess.busy
+func (h *BotHandler) publishCurrentItem(ctx context.Context, b *bot.Bot, sess *forwardSession) bool {
+	return h.publishPage(ctx, b, sess, sess.Index, forwardPage{Preview: sess.Preview, Original: sess.Original})
+}
+
+// publishPage 把一页发到频道并存为 <BaseID>_p<index>
+func (h *BotHandler) publishPage(ctx context.Context, b *bot.Bot, sess *forwardSession, index int, page forwardPage) bool {
+	chatID := sess.ChatID
+	preview := page.Preview
+	original := page.Original
+	baseID := sess.BaseID
+	title := sess.Title
+	artist := sess.Artist
+	tags := sess.Tags
+
+	if preview == nil {
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: "⚠️ 嗷，出错啦：当前没有等待发布的图片哦，没办法继续了喵~。"})
+		return false
+	}
+
+	postID := fmt.Sprintf("%s_p%d", baseID, index)
+
+	caption := title
+	if caption == "" {
+		caption = "MtcACG:TG"
+	}
+	if artist != "" {
+		caption += fmt.Sprintf("\nArtist: %s", artist) // 🔴 新增
+	}
+	caption = fmt.Sprintf("%s [P%d]", caption, index+1)
+	if tags != "" {
+		caption = caption + "\n" + tags
+	}
+
+	dbTags := tags
+	if dbTags == "" {
+		dbTags = "TG-Forward"
+	}
+
+	var previewFileID, originFileID string
+	var width, height int
+
+	// 发送预览图
+	if preview.Photo {
+		var fwdMsg *models.Message
+		err := h.sendQ.Do(ctx, h.Cfg.ChannelID, 1, func(ctx context.Context) (err error) {
+			fwdMsg, err = b.SendPhoto(ctx, &bot.SendPhotoParams{
+				ChatID:  h.Cfg.ChannelID,
+				Photo:   &models.InputFileString{Data: preview.FileID},
+				Caption: caption,
+			})
+			return err
+		})
+		if err != nil {
+			log.Printf("❌ P%d Preview Send Failed: %v", index, err)
+			return false
+		}
+		previewFileID = fwdMsg.Photo[len(fwdMsg.Photo)-1].FileID
+		width = preview.Width
+		height = preview.Height
+
+		if original != nil {
+			originFileID = original.FileID
+		}
+	} else {
+		var fwdMsg *models.Message
+		err := h.sendQ.Do(ctx, h.Cfg.ChannelID, 1, func(ctx context.Context) (err error) {
+			fwdMsg, err = b.SendDocument(ctx, &bot.SendDocumentParams{
+				ChatID:   h.Cfg.ChannelID,
+				Document: &models.InputFileString{Data: preview.FileID},
+				Caption:  caption,
+			})
+			return err
+		})
+		if err != nil {
+			log.Printf("❌ P%d Doc Send Failed: %v", index, err)
+			return false
+		}
+		previewFileID = fwdMsg.Document.FileID
+		originFileID = fwdMsg.Document.FileID
+		if fwdMsg.Document.Thumbnail != nil {
+			width = fwdMsg.Document.Thumbnail.Width
+			height = fwdMsg.Document.Thumbnail.Height
+		}
+	}
+
+	// 补发原图
+	if originFileID != "" && originFileID != previewFileID {
+		var docMsg *models.Message
+		err := h.sendQ.Do(ctx, h.Cfg.ChannelID, 1, func(ctx context.Context) (err error) {
+			docMsg, err = b.SendDocument(ctx, &bot.SendDocumentParams{
+				ChatID:   h.Cfg.ChannelID,
+				Document: &models.InputFileString{Data: originFileID},
+				Caption:  fmt.Sprintf("⬇️ %s P%d Original", title, index),
+			})
+			return err
+		})
+		if err == nil {
+			originFileID = docMsg.Document.FileID
+		}
+	}
+
+	// 存入数据库
+	err := h.DB.SaveImage(database.ImageRecord{
+		PostID:    postID,
+		FileID:    previewFileID,
+		OriginID:  originFileID,
+		Caption:   caption,
+		Artist:    artist,
+		Tags:      dbTags,
+		Width:     width,
+		Height:    height,
+		Platform:  "TG-Forward",
+		ArtworkID: baseID,
+		PageIndex: index,
+	})
+	if err != nil {
+		log.Printf("❌ P%d DB Save Failed: %v", index, err)
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: "❌ 糟了！数据库保存失败，流程暂停。喵呜(^x_x^)"})
+		return false
+	}
+
+	log.Printf("✅ Published: %s", postID)
+	return true
+}
+
+func (h *BotHandler) handleForwardContinue(ctx context.Context, b *bot.Bot, update *models.Update) {
+	go func() {
+		bgCtx := context.Background()
+		sess := h.forwards.get(forwardKeyOf(update.Message))
+		if sess == nil {
+			return
+		}
+		sess.busy.Lock()
+		defer sess.busy.Unlock()
+		if h.forwards.get(sess.forwardKey) != sess {
+			return
+		}
+
+		// 预览图相册没等到原图，只发预览图
+		if len(sess.Album) > 0 {
+			summary := h.publishAlbum(bgCtx, b, sess, pairForwardPages(sess.Album, nil))
+			b.SendMessage(bgCtx, &bot.SendMessageParams{
+				ChatID: sess.ChatID,
+				Text:   fmt.Sprintf("%s⬇️ 正在等待 P%d ...", summary, sess.Index),
+			})
+			return
+		}
+
+		success := h.publishCurrentItem(bgCtx, b, sess)
+		if !success {
+			return
+		}
+
+		prevIndex := sess.Index
+		h.forwards.update(sess, func(sess *forwardSession) {
+			sess.Index++
+			sess.Preview = nil
+			sess.Original = nil
+			sess.State = forwardWaitPreview
+		})
+
+		b.SendMessage(bgCtx, &bot.SendMessageParams{
+			ChatID: sess.ChatID,
+			Text:   fmt.Sprintf("✅ **P%d 已发布** (ID: `%s_p%d`)\n⬇️ 正在等待 **P%d** ...", prevIndex, sess.BaseID, prevIndex, sess.Index),
+		})
+	}()
+}
+
+func (h *BotHandler) handleForwardEnd(ctx context.Context, b *bot.Bot, update *models.Update) {
+	go func() {
+		bgCtx := context.Background()
+		sess := h.forwards.get(forwardKeyOf(update.Message))
+		if sess == nil {
+			return
+		}
+		sess.busy.Lock()
+		defer sess.busy.Unlock()
+		if h.forwards.get(sess.forwardKey) != sess {
+			return
+		}
+
+		if len(sess.Album) > 0 {
+			b.SendMessage(bgCtx, &bot.SendMessageParams{
+				ChatID: sess.ChatID,
+				Text:   h.publishAlbum(bgCtx, b, sess, pairForwardPages(sess.Album, nil)),
+			})
+		} else if sess.Preview != nil {
+			success := h.publishCurrentItem(bgCtx, b, sess)
+			if success {
+				b.SendMessage(bgCtx, &bot.SendMessageParams{
+					ChatID: sess.ChatID,
+					Text:   fmt.Sprintf("✅ **P%d (尾图) 已发布**", sess.Index),
+				})
+			}
+		}
+
+		h.forwards.end(sess.forwardKey)
+
+		b.SendMessage(bgCtx, &bot.SendMessageParams{
+			ChatID:    sess.ChatID,
+			Text:      "🏁 🐱好耶（^-^）**任务完成喵~** 🐱",
+			ParseMode: models.ParseModeMarkdown,
+		})
+	}()
+}
@@ -0,0 +1,152 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// albumWait 是相册最后一条消息之后再等多久，Telegram 把相册拆成多条 update 陆续推送
+const albumWait = 2 * time.Second
+
+// albumCollector 把同一个 media_group_id 的消息攒到一起，最后一条到达 albumWait 后整组交出去
+type albumCollector struct {
+	mu     sync.Mutex
+	groups map[string]*albumGroup
+}
+
+type albumGroup struct {
+	msgs  []*models.Message
+	timer *time.Timer
+}
+
+func newAlbumCollector() *albumCollector {
+	return &albumCollector{groups: make(map[string]*albumGroup)}
+}
+
+// add 把 msg 放进它所在的相册，相册收齐后按消息顺序调用 done
+func (c *albumCollector) add(msg *models.Message, done func(msgs []*models.Message)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := msg.MediaGroupID
+	g := c.groups[id]
+	if g == nil {
+		g = &albumGroup{}
+		c.groups[id] = g
+		g.timer = time.AfterFunc(albumWait, func() {
+			c.mu.Lock()
+			delete(c.groups, id)
+			msgs := g.msgs
+			c.mu.Unlock()
+
+			sort.Slice(msgs, func(i, j int) bool { return msgs[i].ID < msgs[j].ID })
+			done(msgs)
+		})
+	} else {
+		g.timer.Reset(albumWait)
+	}
+	g.msgs = append(g.msgs, msg)
+}
+
+// pairForwardPages 按顺序把预览图和原图文件配成页，多出来的预览图没有原图，多出来的文件同时当预览
+func pairForwardPages(previews, originals []forwardFile) []forwardPage {
+	n := len(previews)
+	if len(originals) > n {
+		n = len(originals)
+	}
+	pages := make([]forwardPage, n)
+	for i := range pages {
+		if i < len(originals) {
+			pages[i].Original = &originals[i]
+			pages[i].Preview = &originals[i]
+		}
+		if i < len(previews) {
+			pages[i].Preview = &previews[i]
+		}
+	}
+	return pages
+}
+
+// handleForwardAlbum 处理转发会话里收到的一整个相册
+// 图片相册先存下来等原图相册，文件相册到了按顺序和存下的预览图配对，整组一次发布
+func (h *BotHandler) handleForwardAlbum(ctx context.Context, b *bot.Bot, sess *forwardSession, msgs []*models.Message) {
+	sess.busy.Lock()
+	defer sess.busy.Unlock()
+	if h.forwards.get(sess.forwardKey) != sess {
+		return
+	}
+
+	var photos, docs []forwardFile
+	for _, msg := range msgs {
+		if len(msg.Photo) > 0 {
+			photo := msg.Photo[len(msg.Photo)-1]
+			photos = append(photos, forwardFile{FileID: photo.FileID, Photo: true, Width: photo.Width, Height: photo.Height})
+		} else if msg.Document != nil {
+			docs = append(docs, forwardFile{FileID: msg.Document.FileID})
+		}
+	}
+	last := msgs[len(msgs)-1]
+
+	if len(docs) == 0 {
+		h.forwards.update(sess, func(sess *forwardSession) {
+			sess.Album = append(sess.Album, photos...)
+			sess.State = forwardAlbumWaitOriginal
+		})
+		log.Printf("🖼 [Forward] 收到 %d 张预览图相册 (共 %d 张待配对)", len(photos), len(sess.Album))
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:          sess.ChatID,
+			Text:            fmt.Sprintf("✅ 收到 %d 张预览图啦，请按同样的顺序发送原图文件相册喵~🐱\n或输入 /forward_continue 只发布预览图。", len(sess.Album)),
+			ReplyParameters: &models.ReplyParameters{MessageID: last.ID},
+		})
+		return
+	}
+
+	log.Printf("📄 [Forward] 收到 %d 个原图文件，与 %d 张预览图配对", len(docs), len(sess.Album)+len(photos))
+	pages := pairForwardPages(append(sess.Album, photos...), docs)
+	summary := h.publishAlbum(ctx, b, sess, pages)
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: sess.ChatID,
+		Text:   fmt.Sprintf("%s⬇️ 正在等待 P%d ...", summary, sess.Index),
+	})
+}
+
+// publishAlbum 依次发布 pages，还没发布的单张预览图排在最前面，返回发给管理员的汇总；调用方持有 sess.busy
+func (h *BotHandler) publishAlbum(ctx context.Context, b *bot.Bot, sess *forwardSession, pages []forwardPage) string {
+	if sess.Preview != nil {
+		pages = append([]forwardPage{{Preview: sess.Preview, Original: sess.Original}}, pages...)
+	}
+
+	var sb strings.Builder
+	ok := 0
+	for i, page := range pages {
+		index := sess.Index + i
+		if h.publishPage(ctx, b, sess, index, page) {
+			ok++
+			fmt.Fprintf(&sb, "✅ %s_p%d", sess.BaseID, index)
+		} else {
+			fmt.Fprintf(&sb, "❌ %s_p%d", sess.BaseID, index)
+		}
+		if page.Original == nil {
+			sb.WriteString(" (无原图)")
+		}
+		sb.WriteString("\n")
+	}
+
+	h.forwards.update(sess, func(sess *forwardSession) {
+		sess.Index += len(pages)
+		sess.Preview = nil
+		sess.Original = nil
+		sess.Album = nil
+		sess.State = forwardWaitPreview
+	})
+
+	return fmt.Sprintf("📚 相册发布完成：%d/%d 张\n%s", ok, len(pages), sb.String())
+}
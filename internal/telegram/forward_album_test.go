@@ -0,0 +1,70 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+)
+
+func TestPairForwardPages(t *testing.T) {
+	p := []forwardFile{{FileID: "p1", Photo: true}, {FileID: "p2", Photo: true}, {FileID: "p3", Photo: true}}
+	o := []forwardFile{{FileID: "o1"}, {FileID: "o2"}}
+
+	ids := func(pages []forwardPage) (got [][2]string) {
+		for _, pg := range pages {
+			var pair [2]string
+			if pg.Preview != nil {
+				pair[0] = pg.Preview.FileID
+			}
+			if pg.Original != nil {
+				pair[1] = pg.Original.FileID
+			}
+			got = append(got, pair)
+		}
+		return got
+	}
+
+	tests := []struct {
+		name                string
+		previews, originals []forwardFile
+		want                [][2]string
+	}{
+		{"one to one", p[:2], o, [][2]string{{"p1", "o1"}, {"p2", "o2"}}},
+		{"extra previews have no original", p, o, [][2]string{{"p1", "o1"}, {"p2", "o2"}, {"p3", ""}}},
+		{"extra files are their own preview", p[:1], o, [][2]string{{"p1", "o1"}, {"o2", "o2"}}},
+		{"files only", nil, o, [][2]string{{"o1", "o1"}, {"o2", "o2"}}},
+		{"previews only", p[:2], nil, [][2]string{{"p1", ""}, {"p2", ""}}},
+		{"empty", nil, nil, nil},
+	}
+	for _, tt := range tests {
+		got := ids(pairForwardPages(tt.previews, tt.originals))
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestAlbumCollectorOrder(t *testing.T) {
+	c := newAlbumCollector()
+	done := make(chan []*models.Message, 1)
+	for _, id := range []int{12, 10, 11} {
+		c.add(&models.Message{ID: id, MediaGroupID: "g"}, func(msgs []*models.Message) { done <- msgs })
+	}
+
+	select {
+	case msgs := <-done:
+		if len(msgs) != 3 || msgs[0].ID != 10 || msgs[1].ID != 11 || msgs[2].ID != 12 {
+			t.Fatalf("album not collected in message order: %v", msgs)
+		}
+	case <-time.After(albumWait + 2*time.Second):
+		t.Fatal("album never completed")
+	}
+}
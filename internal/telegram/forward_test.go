@@ -0,0 +1,90 @@
+package telegram
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 会话落盘后重启能接着用，状态和收到的图都在
+func TestForwardSessionsReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "forward_sessions.json")
+	s := newForwardSessions(path, 30*time.Minute)
+
+	a := &forwardSession{forwardKey: forwardKey{ChatID: 10, UserID: 1}, BaseID: "fw_a", Title: "t", Artist: "someone", Tags: "#tag"}
+	b := &forwardSession{forwardKey: forwardKey{ChatID: 10, UserID: 2}, BaseID: "fw_b"}
+	s.begin(a)
+	s.begin(b)
+	s.update(a, func(sess *forwardSession) {
+		sess.Index = 2
+		sess.State = forwardWaitOriginal
+		sess.Preview = &forwardFile{FileID: "photo", Photo: true, Width: 800, Height: 600}
+	})
+	s.end(b.forwardKey)
+
+	reloaded := newForwardSessions(path, 30*time.Minute)
+	if reloaded.active(b.forwardKey) {
+		t.Fatal("ended session came back after reload")
+	}
+	got := reloaded.get(a.forwardKey)
+	if got == nil {
+		t.Fatal("session lost after reload")
+	}
+	if got.BaseID != "fw_a" || got.Index != 2 || got.State != forwardWaitOriginal || got.Artist != "someone" || got.Tags != "#tag" {
+		t.Fatalf("reloaded session = %+v", got)
+	}
+	if got.Preview == nil || *got.Preview != *a.Preview {
+		t.Fatalf("reloaded preview = %+v", got.Preview)
+	}
+	if !got.UpdatedAt.Equal(a.UpdatedAt) {
+		t.Fatalf("UpdatedAt = %v, want %v", got.UpdatedAt, a.UpdatedAt)
+	}
+}
+
+func TestForwardSessionsTTL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "forward_sessions.json")
+	s := newForwardSessions(path, time.Minute)
+
+	old := &forwardSession{forwardKey: forwardKey{ChatID: 10, UserID: 1}, BaseID: "fw_old"}
+	fresh := &forwardSession{forwardKey: forwardKey{ChatID: 10, UserID: 2}, BaseID: "fw_fresh"}
+	s.begin(old)
+	s.begin(fresh)
+	s.mu.Lock()
+	old.UpdatedAt = time.Now().Add(-2 * time.Minute)
+	s.save()
+	s.mu.Unlock()
+
+	// 超时的会话查不到，但在 sweep 之前还留在文件里
+	if s.active(old.forwardKey) {
+		t.Fatal("expired session still active")
+	}
+	if !s.active(fresh.forwardKey) {
+		t.Fatal("fresh session not active")
+	}
+	if reloaded := newForwardSessions(path, time.Minute); reloaded.active(old.forwardKey) {
+		t.Fatal("expired session active after reload")
+	}
+
+	// 正在发布的会话先不清理
+	old.busy.Lock()
+	if got := s.sweep(time.Now()); len(got) != 0 {
+		t.Fatalf("swept a busy session: %v", got)
+	}
+	old.busy.Unlock()
+
+	got := s.sweep(time.Now())
+	if len(got) != 1 || got[0].BaseID != "fw_old" {
+		t.Fatalf("sweep = %v, want fw_old", got)
+	}
+	reloaded := newForwardSessions(path, time.Minute)
+	if len(reloaded.sessions) != 1 || !reloaded.active(fresh.forwardKey) {
+		t.Fatalf("sessions on disk after sweep = %v", reloaded.sessions)
+	}
+
+	// TTL 为 0 时永不超时
+	forever := newForwardSessions(path, 0)
+	forever.sessions[old.forwardKey] = old
+	if !forever.active(old.forwardKey) || len(forever.sweep(time.Now().Add(24*time.Hour))) != 0 {
+		t.Fatal("session expired with TTL 0")
+	}
+}
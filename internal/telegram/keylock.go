@@ -0,0 +1,57 @@
+package telegram
+
+import (
+	"sort"
+	"sync"
+)
+
+// keyLocks 按字符串加锁，同一个 post ID 同一时间只能有一个 send 在处理
+// 不用的锁会被删掉，map 不会随着发过的图越变越大
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func newKeyLocks() *keyLocks {
+	return &keyLocks{locks: make(map[string]*keyLock)}
+}
+
+// lock 锁住所有 keys，返回解锁函数；按排序后的顺序加锁，两组有交集的 keys 不会互相死锁
+func (k *keyLocks) lock(keys []string) (unlock func()) {
+	keys = append([]string(nil), keys...)
+	sort.Strings(keys)
+	held := make([]string, 0, len(keys))
+	for i, key := range keys {
+		if key == "" || (i > 0 && key == keys[i-1]) {
+			continue
+		}
+		k.mu.Lock()
+		l := k.locks[key]
+		if l == nil {
+			l = &keyLock{}
+			k.locks[key] = l
+		}
+		l.refs++
+		k.mu.Unlock()
+
+		l.mu.Lock()
+		held = append(held, key)
+	}
+
+	return func() {
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		for _, key := range held {
+			l := k.locks[key]
+			l.mu.Unlock()
+			if l.refs--; l.refs == 0 {
+				delete(k.locks, key)
+			}
+		}
+	}
+}
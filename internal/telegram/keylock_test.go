@@ -0,0 +1,41 @@
+package telegram
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyLocks(t *testing.T) {
+	k := newKeyLocks()
+
+	unlock := k.lock([]string{"b", "a", "a", ""})
+	acquired := make(chan struct{})
+	go func() {
+		u := k.lock([]string{"c", "a"})
+		close(acquired)
+		u()
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("overlapping keys locked twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// 不相交的 keys 不受影响
+	k.lock([]string{"c"})()
+	unlock()
+	<-acquired
+
+	// 交叉顺序加锁不会死锁
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() { defer wg.Done(); k.lock([]string{"x", "y"})() }()
+		go func() { defer wg.Done(); k.lock([]string{"y", "x"})() }()
+	}
+	wg.Wait()
+
+	if len(k.locks) != 0 {
+		t.Fatalf("%d locks left after unlocking everything", len(k.locks))
+	}
+}
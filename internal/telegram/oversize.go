@@ -0,0 +1,103 @@
+package telegram
+
+import (
+	"context"
+	"log"
+
+	"my-bot-go/internal/config"
+	"my-bot-go/internal/database"
+	"my-bot-go/internal/imageprep"
+	"my-bot-go/internal/storage"
+)
+
+// maxDocumentBytes 是 Bot API 上传文件的大小上限
+const maxDocumentBytes = 50 * 1024 * 1024
+
+// 超限原图的处理方式，写进 images.original_mode
+const (
+	originalReencode = "reencode" // 无损重编码后发到了 Telegram
+	originalStorage  = "storage"  // 原图存在别的上传后端，origin_id 指向它
+	originalLink     = "link"     // 没存原图，Worker 的下载链接指向 source_url
+	originalMissing  = "missing"  // 所有策略都失败，只有预览图
+)
+
+// newOversizeUploader 返回 storage 策略专用的后端
+// 策略里没有 storage，或者 UPLOAD_BACKENDS 里已经有 Telegram 以外的后端时返回 nil
+func newOversizeUploader(cfg *config.Config, h *BotHandler) (storage.Uploader, error) {
+	if !hasPolicy(cfg, originalStorage) {
+		return nil, nil
+	}
+	for _, u := range h.uploaders {
+		if u.Name() != "telegram" {
+			return nil, nil
+		}
+	}
+	if cfg.OversizeBackend == "telegram" {
+		return nil, nil
+	}
+	return newUploader(cfg, h, cfg.OversizeBackend)
+}
+
+func hasPolicy(cfg *config.Config, name string) bool {
+	for _, p := range cfg.OriginalOversize {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// oversizeDocument 返回超过 50MB 的原图要发给 Telegram 的文件
+// 策略里有 reencode 且无损重编码后能放进限制时返回新的数据，否则返回 nil，只发预览图
+func (h *BotHandler) oversizeDocument(postID string, data []byte) []byte {
+	if !hasPolicy(h.Cfg, originalReencode) {
+		return nil
+	}
+	out, err := imageprep.OptimizePNG(data)
+	if err != nil {
+		log.Printf("⚠️ Original of %s is %.2f MB, cannot re-encode: %v", postID, float64(len(data))/1024/1024, err)
+		return nil
+	}
+	if len(out) > maxDocumentBytes {
+		log.Printf("⚠️ Original of %s is still %.2f MB after re-encoding", postID, float64(len(out))/1024/1024)
+		return nil
+	}
+	log.Printf("🗜️ Re-encoded original of %s: %.2f MB -> %.2f MB", postID,
+		float64(len(data))/1024/1024, float64(len(out))/1024/1024)
+	return out
+}
+
+// resolveOversize 在 Telegram 没存下超限原图时，按 ORIGINAL_OVERSIZE 的顺序给 rec 找一个原图来源
+func (h *BotHandler) resolveOversize(ctx context.Context, rec *database.ImageRecord, obj storage.Object) {
+	for _, p := range h.Cfg.OriginalOversize {
+		switch p {
+		case originalStorage:
+			for _, loc := range rec.Locations {
+				if loc.Backend != "telegram" && loc.Ref != "" {
+					rec.OriginID = loc.GalleryRef(false)
+					rec.OriginalMode = originalStorage
+					return
+				}
+			}
+			if h.oversize == nil {
+				continue
+			}
+			loc, err := h.oversize.Upload(ctx, obj)
+			if err != nil {
+				log.Printf("❌ %s Upload Failed [%s]: %v", h.oversize.Name(), rec.PostID, err)
+				continue
+			}
+			rec.Locations = append(rec.Locations, loc)
+			rec.OriginID = loc.GalleryRef(false)
+			rec.OriginalMode = originalStorage
+			return
+		case originalLink:
+			if rec.SourceURL != "" {
+				rec.OriginalMode = originalLink
+				return
+			}
+		}
+	}
+	log.Printf("⚠️ No original kept for %s, only the preview is saved", rec.PostID)
+	rec.OriginalMode = originalMissing
+}
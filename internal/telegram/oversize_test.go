@@ -0,0 +1,128 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"image/color"
+	"testing"
+
+	"my-bot-go/internal/config"
+	"my-bot-go/internal/database"
+	"my-bot-go/internal/storage"
+)
+
+// fakeUploader 记录上传次数，err 不为 nil 时上传失败
+type fakeUploader struct {
+	name    string
+	err     error
+	uploads int
+}
+
+func (u *fakeUploader) Name() string { return u.name }
+
+func (u *fakeUploader) Upload(ctx context.Context, obj storage.Object) (storage.Location, error) {
+	u.uploads++
+	if u.err != nil {
+		return storage.Location{}, u.err
+	}
+	return storage.Location{Backend: u.name, Ref: obj.Key}, nil
+}
+
+func TestOversizeDocument(t *testing.T) {
+	pngData := testPNG(color.RGBA{R: 1, G: 2, B: 3, A: 255})
+	tests := []struct {
+		name   string
+		policy []string
+		data   []byte
+		want   bool
+	}{
+		{"reencode png", []string{originalReencode, originalLink}, pngData, true},
+		{"reencode not configured", []string{originalStorage, originalLink}, pngData, false},
+		{"not a png", []string{originalReencode}, []byte("\xff\xd8\xff jpeg"), false},
+	}
+	for _, tt := range tests {
+		h := &BotHandler{Cfg: &config.Config{OriginalOversize: tt.policy}}
+		if got := h.oversizeDocument("p", tt.data); (got != nil) != tt.want {
+			t.Errorf("%s: got %d bytes, want re-encoded = %v", tt.name, len(got), tt.want)
+		}
+	}
+}
+
+func TestResolveOversize(t *testing.T) {
+	tgLoc := storage.Location{Backend: "telegram", Ref: "", Preview: "preview"}
+	s3Loc := storage.Location{Backend: "s3", Ref: "pixiv/1.png"}
+
+	tests := []struct {
+		name      string
+		policy    []string
+		locations []storage.Location
+		sourceURL string
+		oversize  *fakeUploader
+
+		mode     string
+		originID string
+		uploads  int
+	}{
+		{"storage reuses an upload backend", []string{originalStorage}, []storage.Location{tgLoc, s3Loc}, "", &fakeUploader{name: "r2"},
+			originalStorage, "s3:pixiv/1.png", 0},
+		{"storage uploads to the oversize backend", []string{originalStorage}, []storage.Location{tgLoc}, "", &fakeUploader{name: "r2"},
+			originalStorage, "r2:pixiv/1.png", 1},
+		{"storage fails, falls back to link", []string{originalStorage, originalLink}, []storage.Location{tgLoc}, "https://www.pixiv.net/artworks/1", &fakeUploader{name: "r2", err: errors.New("down")},
+			originalLink, "", 1},
+		{"storage without backend, falls back to link", []string{originalStorage, originalLink}, []storage.Location{tgLoc}, "https://www.pixiv.net/artworks/1", nil,
+			originalLink, "", 0},
+		{"link without source url", []string{originalLink}, []storage.Location{tgLoc}, "", nil,
+			originalMissing, "", 0},
+		{"no policy", nil, []storage.Location{tgLoc}, "https://www.pixiv.net/artworks/1", nil,
+			originalMissing, "", 0},
+		// reencode 已经在发送时处理过，这里跳过
+		{"reencode only", []string{originalReencode}, []storage.Location{tgLoc}, "https://www.pixiv.net/artworks/1", nil,
+			originalMissing, "", 0},
+	}
+	for _, tt := range tests {
+		h := &BotHandler{Cfg: &config.Config{OriginalOversize: tt.policy}}
+		if tt.oversize != nil {
+			h.oversize = tt.oversize
+		}
+		rec := database.ImageRecord{PostID: "pixiv_1_p0", SourceURL: tt.sourceURL, Locations: tt.locations}
+		h.resolveOversize(context.Background(), &rec, storage.Object{Key: "pixiv/1.png"})
+
+		if rec.OriginalMode != tt.mode || rec.OriginID != tt.originID {
+			t.Errorf("%s: got mode %q origin %q, want %q %q", tt.name, rec.OriginalMode, rec.OriginID, tt.mode, tt.originID)
+		}
+		if tt.oversize != nil && tt.oversize.uploads != tt.uploads {
+			t.Errorf("%s: %d uploads, want %d", tt.name, tt.oversize.uploads, tt.uploads)
+		}
+	}
+}
+
+func TestNewOversizeUploader(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    []string
+		uploaders []storage.Uploader
+		backend   string
+		want      string
+	}{
+		{"no storage policy", []string{originalReencode, originalLink}, []storage.Uploader{&fakeUploader{name: "telegram"}}, "local", ""},
+		{"already uploading elsewhere", []string{originalStorage}, []storage.Uploader{&fakeUploader{name: "telegram"}, &fakeUploader{name: "s3"}}, "local", ""},
+		{"backend is telegram", []string{originalStorage}, []storage.Uploader{&fakeUploader{name: "telegram"}}, "telegram", ""},
+		{"local backend", []string{originalStorage}, []storage.Uploader{&fakeUploader{name: "telegram"}}, "local", "local"},
+	}
+	for _, tt := range tests {
+		cfg := &config.Config{OriginalOversize: tt.policy, OversizeBackend: tt.backend, LocalDir: t.TempDir()}
+		h := &BotHandler{Cfg: cfg, uploaders: tt.uploaders}
+		u, err := newOversizeUploader(cfg, h)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		got := ""
+		if u != nil {
+			got = u.Name()
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// handleQueue 查看写库失败、正在等待重试的行
+func (h *BotHandler) handleQueue(ctx context.Context, b *bot.Bot, update *models.Update) {
+	entries := h.DB.Queue().Entries()
+	if len(entries) == 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   "✅ 写库队列是空的喵~",
+		})
+		return
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📥 待重试 %d 条：\n", len(entries))
+	const maxShown = 20
+	for i, e := range entries {
+		if i >= maxShown {
+			fmt.Fprintf(&sb, "... 还有 %d 条\n", len(entries)-maxShown)
+			break
+		}
+		fmt.Fprintf(&sb, "• %s (第 %d 次，%s 后重试)\n  %s\n",
+			e.Row.PostID, e.Attempts+1, time.Until(e.NextRetry).Round(time.Second), e.LastError)
+	}
+	sb.WriteString("\n输入 /queue_flush 立即重试全部")
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   sb.String(),
+	})
+}
+
+// handleQueueFlush 忽略退避时间，立即重试队列里的所有行
+func (h *BotHandler) handleQueueFlush(ctx context.Context, b *bot.Bot, update *models.Update) {
+	userID := update.Message.From.ID
+
+	go func() {
+		bgCtx := context.Background()
+		saved, left := h.DB.Queue().Flush()
+		log.Printf("📤 Manual queue flush by UserID %d: %d saved, %d left", userID, saved, left)
+		b.SendMessage(bgCtx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   fmt.Sprintf("📤 已写入 %d 条，剩余 %d 条", saved, left),
+		})
+	}()
+}
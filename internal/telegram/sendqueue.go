@@ -0,0 +1,165 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"my-bot-go/internal/scheduler"
+
+	"github.com/go-telegram/bot"
+)
+
+const (
+	sendMaxAttempts = 5
+	sendRetryBase   = 2 * time.Second
+)
+
+// 只在拿不到类型化错误时按错误信息兜底，覆盖 go-telegram/bot 新旧两种格式
+var (
+	statusCodeRe = regexp.MustCompile(`statusCode (\d+)|error response from telegram for method \w+, (\d+)`)
+	retryAfterRe = regexp.MustCompile(`"?retry_after"?:?\s*(\d+)`)
+)
+
+// sendQueue 把发往频道的请求排成一队：同一时间只发一个，每个 chat 按 TG_RATE_PER_MINUTE 控制速率，
+// 遇到 429 按 Telegram 给的 retry_after 等待后重发，网络错误和 5xx 按指数退避重试
+// 爬虫不需要再在每张图之间 sleep
+type sendQueue struct {
+	mu       sync.Mutex    // 发送时一直持有，保证同一时间只发一个
+	interval time.Duration // 同一个 chat 每条消息占用的时间
+
+	// 下面的状态单独加锁，/status 读取时不用等正在进行的发送
+	stateMu     sync.Mutex
+	next        map[int64]time.Time // 每个 chat 下一次可以发送的时间
+	lastLimited time.Time           // 最近一次 429 的时间
+	retryAfter  time.Duration       // 最近一次 429 给的 retry_after
+}
+
+// sendQueueStatus 是 /status 显示的发送队列状态
+type sendQueueStatus struct {
+	Wait        time.Duration // 这个 chat 还要等多久才能发下一条
+	LastLimited time.Time
+	RetryAfter  time.Duration
+}
+
+func (q *sendQueue) status(chatID int64) sendQueueStatus {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+	st := sendQueueStatus{LastLimited: q.lastLimited, RetryAfter: q.retryAfter}
+	if wait := time.Until(q.next[chatID]); wait > 0 {
+		st.Wait = wait
+	}
+	return st
+}
+
+func (q *sendQueue) nextAt(chatID int64) time.Time {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+	return q.next[chatID]
+}
+
+func (q *sendQueue) setNext(chatID int64, t time.Time) {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+	q.next[chatID] = t
+}
+
+func newSendQueue(perMinute int) *sendQueue {
+	if perMinute <= 0 {
+		perMinute = 20
+	}
+	return &sendQueue{
+		interval: time.Minute / time.Duration(perMinute),
+		next:     make(map[int64]time.Time),
+	}
+}
+
+// Do 排队执行 fn，cost 是这次请求会产生的消息数 (相册里的每张图都算一条)
+// fn 每次重试都会被重新调用，上传用的 Reader 要在 fn 里面创建
+func (q *sendQueue) Do(ctx context.Context, chatID int64, cost int, fn func(ctx context.Context) error) error {
+	if cost < 1 {
+		cost = 1
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var err error
+	for attempt := 1; attempt <= sendMaxAttempts; attempt++ {
+		if wait := time.Until(q.nextAt(chatID)); wait > 0 {
+			if !scheduler.Sleep(ctx, wait) {
+				return ctx.Err()
+			}
+		}
+
+		err = fn(ctx)
+		if err == nil {
+			q.setNext(chatID, time.Now().Add(q.interval*time.Duration(cost)))
+			return nil
+		}
+
+		retryAfter, transient := classifySendError(err)
+		switch {
+		case retryAfter > 0:
+			log.Printf("⏳ Telegram rate limited, retry after %s (attempt %d/%d)", retryAfter, attempt, sendMaxAttempts)
+			q.stateMu.Lock()
+			q.next[chatID] = time.Now().Add(retryAfter)
+			q.lastLimited = time.Now()
+			q.retryAfter = retryAfter
+			q.stateMu.Unlock()
+		case transient:
+			backoff := sendRetryBase << (attempt - 1)
+			log.Printf("🔁 Telegram send failed, retry in %s (attempt %d/%d): %v", backoff, attempt, sendMaxAttempts, err)
+			q.setNext(chatID, time.Now().Add(backoff))
+		default:
+			return err
+		}
+	}
+	return err
+}
+
+// classifySendError 取出 429 的 retry_after，并判断是否值得重试
+// 优先用 go-telegram/bot 的类型化错误，错误信息只作为兜底
+func classifySendError(err error) (retryAfter time.Duration, transient bool) {
+	var tooMany *bot.TooManyRequestsError
+	if errors.As(err, &tooMany) {
+		retryAfter = time.Duration(tooMany.RetryAfter) * time.Second
+		if retryAfter <= 0 {
+			retryAfter = time.Second
+		}
+		return retryAfter, true
+	}
+	for _, permanent := range []error{bot.ErrorBadRequest, bot.ErrorForbidden, bot.ErrorUnauthorized, bot.ErrorNotFound, bot.ErrorConflict} {
+		if errors.Is(err, permanent) {
+			return 0, false
+		}
+	}
+	// 请求没发出去或者响应没读完
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, true
+	}
+
+	msg := err.Error()
+	if m := statusCodeRe.FindStringSubmatch(msg); m != nil {
+		code, _ := strconv.Atoi(m[1] + m[2])
+		if code == 429 {
+			retryAfter = time.Second
+			if r := retryAfterRe.FindStringSubmatch(msg); r != nil {
+				if n, _ := strconv.Atoi(r[1]); n > 0 {
+					retryAfter = time.Duration(n) * time.Second
+				}
+			}
+			return retryAfter, true
+		}
+		return 0, code >= 500
+	}
+	return 0, strings.Contains(msg, "error do request") || strings.Contains(msg, "error read response body")
+}
@@ -0,0 +1,101 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+)
+
+func TestClassifySendError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		retryAfter time.Duration
+		transient  bool
+	}{
+		{"typed 429", &bot.TooManyRequestsError{Message: "too many requests", RetryAfter: 17}, 17 * time.Second, true},
+		{"typed 429 without retry_after", &bot.TooManyRequestsError{Message: "too many requests"}, time.Second, true},
+		{"wrapped typed 429", fmt.Errorf("send album: %w", &bot.TooManyRequestsError{RetryAfter: 3}), 3 * time.Second, true},
+		{"bad request", fmt.Errorf("%w, %s", bot.ErrorBadRequest, "PHOTO_INVALID_DIMENSIONS"), 0, false},
+		{"forbidden", fmt.Errorf("%w, %s", bot.ErrorForbidden, "bot was kicked"), 0, false},
+		{"network", fmt.Errorf("error do request for method sendPhoto, %w", &url.Error{Op: "Post", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}), 0, true},
+		{"server error", errors.New("error response from telegram for method sendPhoto, 502 Bad Gateway"), 0, true},
+		// 旧版 go-telegram/bot 的错误信息
+		{"legacy 429", errors.New(`unexpected response statusCode 429 for method sendPhoto, {"ok":false,"error_code":429,"parameters":{"retry_after": 35}}`), 35 * time.Second, true},
+		{"legacy 500", errors.New("unexpected response statusCode 500 for method sendPhoto, oops"), 0, true},
+		{"legacy 400", errors.New("unexpected response statusCode 400 for method sendPhoto, bad"), 0, false},
+		{"legacy read body", errors.New("error read response body for method sendPhoto, unexpected EOF"), 0, true},
+		{"unknown", errors.New("something else"), 0, false},
+	}
+	for _, tt := range tests {
+		retryAfter, transient := classifySendError(tt.err)
+		if retryAfter != tt.retryAfter || transient != tt.transient {
+			t.Errorf("%s: got (%v, %v), want (%v, %v)", tt.name, retryAfter, transient, tt.retryAfter, tt.transient)
+		}
+	}
+}
+
+func TestSendQueueDo(t *testing.T) {
+	q := newSendQueue(60 * 1000) // 每条只占 1ms
+	ctx := context.Background()
+
+	calls := 0
+	if err := q.Do(ctx, 1, 1, func(context.Context) error { calls++; return nil }); err != nil || calls != 1 {
+		t.Fatalf("Do = %v after %d calls", err, calls)
+	}
+
+	// 不值得重试的错误直接返回
+	calls = 0
+	badRequest := fmt.Errorf("%w, %s", bot.ErrorBadRequest, "wrong file")
+	if err := q.Do(ctx, 1, 1, func(context.Context) error { calls++; return badRequest }); !errors.Is(err, bot.ErrorBadRequest) || calls != 1 {
+		t.Fatalf("Do = %v after %d calls, want bad request after 1 call", err, calls)
+	}
+}
+
+func TestSendQueueRetryAfter(t *testing.T) {
+	q := newSendQueue(60 * 1000)
+	calls := 0
+	start := time.Now()
+	err := q.Do(context.Background(), 5, 1, func(context.Context) error {
+		calls++
+		if calls == 1 {
+			return &bot.TooManyRequestsError{RetryAfter: 1}
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("Do = %v after %d calls", err, calls)
+	}
+	if waited := time.Since(start); waited < time.Second {
+		t.Fatalf("retried after %s, want at least retry_after", waited)
+	}
+
+	st := q.status(5)
+	if st.LastLimited.IsZero() || st.RetryAfter != time.Second {
+		t.Fatalf("status = %+v, want last 429 recorded", st)
+	}
+}
+
+func TestSendQueueCancelWhileWaiting(t *testing.T) {
+	q := newSendQueue(60)
+	q.setNext(1, time.Now().Add(time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := q.Do(ctx, 1, 1, func(context.Context) error {
+		t.Fatal("fn called while the chat is still rate limited")
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Do = %v, want deadline exceeded", err)
+	}
+	if st := q.status(1); st.Wait <= 0 {
+		t.Fatalf("status wait = %v, want > 0", st.Wait)
+	}
+}
@@ -0,0 +1,86 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"my-bot-go/internal/metrics"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// handleStatus 汇报各图源最近一轮的情况、历史记录和写库队列、频道的发送限速
+func (h *BotHandler) handleStatus(ctx context.Context, b *bot.Bot, update *models.Update) {
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   h.statusText(time.Now()),
+	})
+}
+
+func (h *BotHandler) statusText(now time.Time) string {
+	var sb strings.Builder
+	sb.WriteString("📊 运行状态\n")
+	fmt.Fprintf(&sb, "🕒 已运行 %s\n", now.Sub(h.started).Round(time.Second))
+	fmt.Fprintf(&sb, "📚 历史记录 %d 条\n", h.DB.HistorySize())
+	fmt.Fprintf(&sb, "📥 写库队列 %d 条待重试\n", h.DB.Queue().Len())
+
+	q := h.sendQ.status(h.Cfg.ChannelID)
+	if q.Wait > 0 {
+		fmt.Fprintf(&sb, "📨 频道发送：等待 %s\n", q.Wait.Round(time.Second))
+	} else {
+		sb.WriteString("📨 频道发送：空闲\n")
+	}
+	if !q.LastLimited.IsZero() {
+		fmt.Fprintf(&sb, "⏳ 最近一次限流 %s (retry_after %s)\n", formatTime(q.LastLimited), q.RetryAfter)
+	}
+
+	sources := h.metrics.Snapshot()
+	if len(sources) == 0 {
+		sb.WriteString("\n没有启用的图源")
+		return sb.String()
+	}
+	for _, st := range sources {
+		sb.WriteString("\n")
+		writeSourceStatus(&sb, st, now)
+	}
+	return sb.String()
+}
+
+func writeSourceStatus(sb *strings.Builder, st metrics.SourceStats, now time.Time) {
+	switch {
+	case st.Running:
+		fmt.Fprintf(sb, "🟢 %s 运行中 (第 %d 轮，已运行 %s)\n", st.Name, st.Runs, now.Sub(st.LastStart).Round(time.Second))
+	case st.Runs == 0:
+		fmt.Fprintf(sb, "⚪ %s 还没运行过\n", st.Name)
+	default:
+		fmt.Fprintf(sb, "⚪ %s 空闲 (已运行 %d 轮)\n", st.Name, st.Runs)
+	}
+	if st.Running {
+		fmt.Fprintf(sb, "  开始：%s\n", formatTime(st.LastStart))
+	} else if st.Runs > 0 {
+		fmt.Fprintf(sb, "  上次：%s → %s\n", formatTime(st.LastStart), formatTime(st.LastEnd))
+	}
+	if st.Runs > 0 {
+		fmt.Fprintf(sb, "  作品 %d · 发送 %d · 跳过 %d · 失败 %d\n", st.Found, st.Sent, st.Skipped, st.Failed)
+	}
+	if !st.NextRun.IsZero() {
+		fmt.Fprintf(sb, "  下次：%s", formatTime(st.NextRun))
+		if d := st.NextRun.Sub(now); d > 0 {
+			fmt.Fprintf(sb, " (%s 后)", d.Round(time.Second))
+		}
+		sb.WriteString("\n")
+	}
+	if st.LastError != "" {
+		fmt.Fprintf(sb, "  ⚠️ %s\n", st.LastError)
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("01-02 15:04:05")
+}
@@ -0,0 +1,77 @@
+package telegram
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"my-bot-go/internal/database"
+	"my-bot-go/internal/metrics"
+)
+
+func TestWriteSourceStatus(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		name string
+		st   metrics.SourceStats
+		want string
+	}{
+		{"never run", metrics.SourceStats{Name: "pixiv"},
+			"⚪ pixiv 还没运行过\n"},
+		{"never run with schedule", metrics.SourceStats{Name: "pixiv", NextRun: now.Add(90 * time.Second)},
+			"⚪ pixiv 还没运行过\n  下次：05-01 12:01:30 (1m30s 后)\n"},
+		{"running", metrics.SourceStats{Name: "yande", Running: true, Runs: 3, LastStart: now.Add(-75 * time.Second), Found: 4, Sent: 2},
+			"🟢 yande 运行中 (第 3 轮，已运行 1m15s)\n  开始：05-01 11:58:45\n  作品 4 · 发送 2 · 跳过 0 · 失败 0\n"},
+		{"idle with error and overdue run", metrics.SourceStats{
+			Name: "mtcacg", Runs: 5,
+			LastStart: now.Add(-10 * time.Minute), LastEnd: now.Add(-9 * time.Minute),
+			NextRun: now.Add(-time.Second), LastError: "403 Forbidden",
+			Found: 10, Sent: 1, Skipped: 8, Failed: 1,
+		}, "⚪ mtcacg 空闲 (已运行 5 轮)\n  上次：05-01 11:50:00 → 05-01 11:51:00\n  作品 10 · 发送 1 · 跳过 8 · 失败 1\n  下次：05-01 11:59:59\n  ⚠️ 403 Forbidden\n"},
+	}
+	for _, tt := range tests {
+		var sb strings.Builder
+		writeSourceStatus(&sb, tt.st, now)
+		if got := sb.String(); got != tt.want {
+			t.Errorf("%s:\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStatusText(t *testing.T) {
+	api := newFakeAPI(t)
+	h := newTestHandler(t, api, nil)
+	now := time.Now()
+	h.started = now.Add(-2 * time.Hour)
+
+	if got := h.statusText(now); !strings.HasSuffix(got, "\n没有启用的图源") {
+		t.Fatalf("status without sources:\n%s", got)
+	}
+
+	h.DB.MarkSeen("a", "b", "c")
+	h.DB.Queue().Push(database.ImageRecord{PostID: "q"}, errors.New("d1 down"))
+	h.metrics.Source("yande")
+	src := h.metrics.Source("pixiv")
+	src.Start()
+	src.End(errors.New("boom"))
+	h.sendQ.setNext(h.Cfg.ChannelID, now.Add(time.Minute))
+
+	got := h.statusText(now)
+	for _, want := range []string{
+		"📊 运行状态\n🕒 已运行 2h0m0s\n📚 历史记录 3 条\n📥 写库队列 1 条待重试\n📨 频道发送：等待 ",
+		"\n⚪ pixiv 空闲 (已运行 1 轮)\n",
+		"  ⚠️ boom\n",
+		"\n⚪ yande 还没运行过\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("status missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Index(got, "pixiv") > strings.Index(got, "yande") {
+		t.Errorf("sources not sorted by name:\n%s", got)
+	}
+	if strings.Contains(got, "最近一次限流") {
+		t.Errorf("rate limit shown before any 429:\n%s", got)
+	}
+}
@@ -0,0 +1,291 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"my-bot-go/internal/config"
+	"my-bot-go/internal/database"
+	"my-bot-go/internal/imageprep"
+	"my-bot-go/internal/storage"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// telegramUploader 把预览图发到频道，再回复一条原图文件，是默认的上传后端
+type telegramUploader struct {
+	h *BotHandler
+}
+
+func (u *telegramUploader) Name() string { return "telegram" }
+
+// preview 返回发到频道的预览图：转正、去透明、缩放压缩到 Telegram 的 photo 限制以内
+// 解不开的格式 (不认识或已损坏的文件) 返回 imageprep.ErrUnsupported，Telegram 也不收，不能原样当 photo 发
+// 其它处理失败时原样发送，让 Telegram 自己处理
+func (u *telegramUploader) preview(obj storage.Object) ([]byte, error) {
+	res, err := imageprep.ForTelegram(obj.Data, imageprep.Options{Background: u.h.Cfg.PreviewBackground})
+	if errors.Is(err, imageprep.ErrUnsupported) {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("❌ Preparing preview for %s failed: %v. Trying original...", obj.Key, err)
+		return obj.Data, nil
+	}
+	if res.Changed {
+		log.Printf("📉 Preview %s: %.2f MB -> %.2f MB (%dx%d)", obj.Key,
+			float64(len(obj.Data))/1024/1024, float64(len(res.Data))/1024/1024, res.Width, res.Height)
+	}
+	return res.Data, nil
+}
+
+// do 通过发送队列发往频道，cost 是这次产生的消息数
+func (u *telegramUploader) do(ctx context.Context, cost int, fn func(ctx context.Context) error) error {
+	return u.h.sendQ.Do(ctx, u.h.Cfg.ChannelID, cost, fn)
+}
+
+func (u *telegramUploader) Upload(ctx context.Context, obj storage.Object) (storage.Location, error) {
+	finalData, err := u.preview(obj)
+	if err != nil {
+		return u.uploadFileOnly(ctx, obj, err)
+	}
+
+	var msg *models.Message
+	err = u.do(ctx, 1, func(ctx context.Context) (err error) {
+		// 每次重试都要新的 Reader
+		msg, err = u.h.API.SendPhoto(ctx, &bot.SendPhotoParams{
+			ChatID:  u.h.Cfg.ChannelID,
+			Photo:   &models.InputFileUpload{Filename: obj.Platform + fileExt(finalData), Data: bytes.NewReader(finalData)},
+			Caption: obj.Caption,
+		})
+		return err
+	})
+	if err != nil {
+		return storage.Location{}, err
+	}
+	if len(msg.Photo) == 0 {
+		return storage.Location{}, errors.New("sendPhoto returned no photo")
+	}
+	loc := storage.Location{Backend: "telegram", Preview: msg.Photo[len(msg.Photo)-1].FileID}
+	u.sendDocument(ctx, obj, msg.ID, &loc)
+	return loc, nil
+}
+
+// uploadFileOnly 在做不出预览图时把原图作为文件直接发到频道，图库的预览和原图都指向这个文件
+// 原图也发不了 (超过 50MB) 时返回错误，由后面的上传后端或 send 的失败计数处理
+func (u *telegramUploader) uploadFileOnly(ctx context.Context, obj storage.Object, cause error) (storage.Location, error) {
+	if obj.Document == nil {
+		return storage.Location{}, fmt.Errorf("no preview (%w) and the original is too large to send", cause)
+	}
+	log.Printf("⚠️ No preview for %s (%v), sending the original as a file", obj.Key, cause)
+
+	var msg *models.Message
+	err := u.do(ctx, 1, func(ctx context.Context) (err error) {
+		msg, err = u.h.API.SendDocument(ctx, &bot.SendDocumentParams{
+			ChatID: u.h.Cfg.ChannelID,
+			Document: &models.InputFileUpload{
+				Filename: obj.Platform + "_original" + fileExt(obj.Document),
+				Data:     bytes.NewReader(obj.Document),
+			},
+			Caption: obj.Caption,
+		})
+		return err
+	})
+	if err != nil {
+		return storage.Location{}, err
+	}
+	if msg.Document == nil {
+		return storage.Location{}, errors.New("sendDocument returned no document")
+	}
+	return storage.Location{Backend: "telegram", Ref: msg.Document.FileID}, nil
+}
+
+// sendDocument 把原图作为文件回复在 replyTo 下面，成功时记到 loc.Ref；obj.Document 为 nil 时不发
+func (u *telegramUploader) sendDocument(ctx context.Context, obj storage.Object, replyTo int, loc *storage.Location) {
+	if obj.Document == nil {
+		return
+	}
+	var msgDoc *models.Message
+	errDoc := u.do(ctx, 1, func(ctx context.Context) (err error) {
+		msgDoc, err = u.h.API.SendDocument(ctx, &bot.SendDocumentParams{
+			ChatID: u.h.Cfg.ChannelID,
+			Document: &models.InputFileUpload{
+				Filename: obj.Platform + "_original" + fileExt(obj.Document),
+				Data:     bytes.NewReader(obj.Document),
+			},
+			ReplyParameters: &models.ReplyParameters{
+				MessageID: replyTo,
+			},
+			Caption: "⬇️ Original File",
+		})
+		return err
+	})
+	if errDoc != nil {
+		log.Printf("⚠️ SendDocument Failed (Will only save preview): %v", errDoc)
+	} else {
+		loc.Ref = msgDoc.Document.FileID
+	}
+}
+
+// UploadBatch 把一组图作为相册发到频道，再把原图作为文件相册回复在第一张图下面
+// 相册发送失败时退回逐张发送，做不出预览图的在相册之后单独作为文件发送
+func (u *telegramUploader) UploadBatch(ctx context.Context, objs []storage.Object) ([]storage.Location, []error) {
+	locs := make([]storage.Location, len(objs))
+	errs := make([]error, len(objs))
+
+	previews := make([][]byte, len(objs))
+	prepErrs := make([]error, len(objs))
+	var album []int
+	for i, obj := range objs {
+		previews[i], prepErrs[i] = u.preview(obj)
+		if prepErrs[i] == nil {
+			album = append(album, i)
+		}
+	}
+
+	switch len(album) {
+	case 0:
+	case 1:
+		// 只剩一张没法组相册
+		locs[album[0]], errs[album[0]] = u.Upload(ctx, objs[album[0]])
+	default:
+		u.uploadAlbum(ctx, objs, previews, album, locs, errs)
+	}
+
+	for i, obj := range objs {
+		if prepErrs[i] != nil {
+			locs[i], errs[i] = u.uploadFileOnly(ctx, obj, prepErrs[i])
+		}
+	}
+	return locs, errs
+}
+
+// uploadAlbum 把 objs 里下标为 idx 的图按相册发送，结果写进 locs 和 errs 的对应位置
+func (u *telegramUploader) uploadAlbum(ctx context.Context, objs []storage.Object, previews [][]byte, idx []int, locs []storage.Location, errs []error) {
+	var msgs []*models.Message
+	err := u.do(ctx, len(idx), func(ctx context.Context) (err error) {
+		photos := make([]models.InputMedia, len(idx))
+		for j, i := range idx {
+			name := fmt.Sprintf("%s_%d%s", objs[i].Platform, i+1, fileExt(previews[i]))
+			photo := &models.InputMediaPhoto{Media: "attach://" + name, MediaAttachment: bytes.NewReader(previews[i])}
+			if j == 0 {
+				// 相册只显示一条说明，放在第一张上
+				photo.Caption = objs[i].Caption
+			}
+			photos[j] = photo
+		}
+		msgs, err = u.h.API.SendMediaGroup(ctx, &bot.SendMediaGroupParams{
+			ChatID: u.h.Cfg.ChannelID,
+			Media:  photos,
+		})
+		return err
+	})
+	if err != nil {
+		log.Printf("⚠️ sendMediaGroup failed, falling back to single sends: %v", err)
+		for _, i := range idx {
+			locs[i], errs[i] = u.Upload(ctx, objs[i])
+		}
+		return
+	}
+
+	for j, i := range idx {
+		if j >= len(msgs) || len(msgs[j].Photo) == 0 {
+			errs[i] = errors.New("sendMediaGroup returned no photo")
+			continue
+		}
+		locs[i] = storage.Location{Backend: "telegram", Preview: msgs[j].Photo[len(msgs[j].Photo)-1].FileID}
+	}
+
+	// 超限又没法重编码的原图不发，剩下的只有一张时没法组相册，单独回复
+	var docIdx []int
+	for _, i := range idx {
+		if objs[i].Document != nil && errs[i] == nil {
+			docIdx = append(docIdx, i)
+		}
+	}
+	switch len(docIdx) {
+	case 0:
+		return
+	case 1:
+		u.sendDocument(ctx, objs[docIdx[0]], msgs[0].ID, &locs[docIdx[0]])
+		return
+	}
+
+	var docMsgs []*models.Message
+	errDoc := u.do(ctx, len(docIdx), func(ctx context.Context) (err error) {
+		docs := make([]models.InputMedia, len(docIdx))
+		for j, i := range docIdx {
+			name := fmt.Sprintf("%s_original_%d%s", objs[i].Platform, i+1, fileExt(objs[i].Document))
+			doc := &models.InputMediaDocument{Media: "attach://" + name, MediaAttachment: bytes.NewReader(objs[i].Document)}
+			if j == len(docIdx)-1 {
+				doc.Caption = "⬇️ Original Files"
+			}
+			docs[j] = doc
+		}
+		docMsgs, err = u.h.API.SendMediaGroup(ctx, &bot.SendMediaGroupParams{
+			ChatID:          u.h.Cfg.ChannelID,
+			Media:           docs,
+			ReplyParameters: &models.ReplyParameters{MessageID: msgs[0].ID},
+		})
+		return err
+	})
+	if errDoc != nil {
+		log.Printf("⚠️ Original album Failed (Will only save previews): %v", errDoc)
+		return
+	}
+	for j, m := range docMsgs {
+		if j < len(docIdx) && m.Document != nil {
+			locs[docIdx[j]].Ref = m.Document.FileID
+		}
+	}
+}
+
+// newUploaders 按 UPLOAD_BACKENDS 的顺序创建上传后端
+func newUploaders(cfg *config.Config, h *BotHandler) ([]storage.Uploader, error) {
+	var list []storage.Uploader
+	for _, name := range cfg.UploadBackends {
+		u, err := newUploader(cfg, h, name)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, u)
+	}
+	if len(list) == 0 {
+		return nil, errors.New("UPLOAD_BACKENDS is empty")
+	}
+	return list, nil
+}
+
+func newUploader(cfg *config.Config, h *BotHandler, name string) (storage.Uploader, error) {
+	switch name {
+	case "telegram":
+		return &telegramUploader{h: h}, nil
+	case "s3":
+		u, err := storage.NewS3Uploader(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3PublicURL)
+		if err != nil {
+			return nil, fmt.Errorf("s3 uploader: %w", err)
+		}
+		return u, nil
+	case "local":
+		return storage.NewLocalUploader(cfg.LocalDir, cfg.LocalPublicURL), nil
+	default:
+		return nil, fmt.Errorf("unknown upload backend: %s", name)
+	}
+}
+
+// storageKey 返回对象存储里的路径：<platform>/<post ID><后缀>
+func storageKey(rec database.ImageRecord, mimeType string) string {
+	platform := rec.Platform
+	if platform == "" {
+		platform = "misc"
+	}
+	return platform + "/" + rec.PostID + storage.Ext(mimeType)
+}
+
+// fileExt 按内容返回发给 Telegram 的文件后缀，Telegram 靠文件名判断类型
+func fileExt(data []byte) string {
+	return storage.Ext(imageprep.DetectMIME(data))
+}
@@ -17,6 +17,7 @@ type YandePostLink struct {
 	Tags      string `json:"tags"`
 	Width     int    `json:"width"`
 	Height    int    `json:"height"`
+	Rating    string `json:"rating"` // s / q / e
 }
 
 //根据 ID 获取图片详情
@@ -1,7 +1,9 @@
 import { htmlHome, htmlAbout } from './templates.js';
 import { proxyTelegramImage, handleDetail, handleApiPosts, handleBgRandom } from './logic.js';
+import { isStoredRef, proxyStoredImage } from './logic.js';
 import { handleArtists } from './logic.js';
 import { handleArtistProfile } from './logic.js';
+import { handleHistoryChanges, handleHistoryAppend } from './logic.js';
 
 export default {
   async fetch(request, env, ctx) {
@@ -19,11 +21,13 @@ export default {
       const cache = caches.default;
       let response = await cache.match(request);
       
-      // 如果缓存没命中，去 Telegram 拿
+      // 如果缓存没命中，去 Telegram (或对象存储) 拿
       if (!response) {
-        const fileId = path.replace('/image/', '');
+        const fileId = decodeURIComponent(path.replace('/image/', ''));
         const dlExt = url.searchParams.get('dl');
-        response = await proxyTelegramImage(fileId, env.BOT_TOKEN, dlExt);
+        response = isStoredRef(fileId)
+          ? await proxyStoredImage(fileId, env, dlExt)
+          : await proxyTelegramImage(fileId, env.BOT_TOKEN, dlExt);
         
         // 只有成功才写入缓存
         if (response.status === 200) {
@@ -46,6 +50,15 @@ export default {
       return await handleBgRandom(false, url, env);
     }
 
+    // Bot 历史记录增量同步
+    if (path === '/api/history/changes') {
+      return await handleHistoryChanges(url, env);
+    }
+
+    if (path === '/api/history/append' && request.method === 'POST') {
+      return await handleHistoryAppend(request, env);
+    }
+
 
     // 4. 详情页路由
     const detailMatch = path.match(/^\/detail\/(.+)$/);
@@ -4,6 +4,9 @@ import { SIDEBAR_HTML, htmlDetail } from './templates.js';
 export async function handleApiPosts(url, env) {
   const q = url.searchParams.get('q');
   const offset = url.searchParams.get('offset') || 0;
+  // 按真实字段过滤：?platform=pixiv&r18=0
+  const platform = url.searchParams.get('platform');
+  const r18 = url.searchParams.get('r18');
 
   // 随机图逻辑
   if (q === 'random') {
@@ -12,23 +15,26 @@ export async function handleApiPosts(url, env) {
   }
 
   // 搜索构建逻辑
-  let sql;
+  const conditions = [];
   let params = [];
   if (q) {
     const keywords = q.replace(/#/g, '').trim().split(/\s+/).filter(k => k.length > 0);
-    if (keywords.length > 0) {
-      const conditions = keywords.map(() => `(tags LIKE ? OR caption LIKE ?)`).join(' AND ');
-      sql = `SELECT * FROM images WHERE ${conditions} ORDER BY created_at DESC LIMIT 20 OFFSET ?`;
-      keywords.forEach(k => { params.push(`%${k}%`); params.push(`%${k}%`); });
-      params.push(offset);
-    } else {
-      sql = `SELECT * FROM images ORDER BY created_at DESC LIMIT 20 OFFSET ?`;
-      params = [offset];
-    }
-  } else {
-    sql = `SELECT * FROM images ORDER BY created_at DESC LIMIT 20 OFFSET ?`;
-    params = [offset];
+    keywords.forEach(k => {
+      conditions.push(`(tags LIKE ? OR caption LIKE ? OR platform = ?)`);
+      params.push(`%${k}%`, `%${k}%`, k);
+    });
+  }
+  if (platform) {
+    conditions.push(`platform = ?`);
+    params.push(platform);
   }
+  if (r18 === '0' || r18 === '1') {
+    conditions.push(`r18 = ?`);
+    params.push(Number(r18));
+  }
+  const where = conditions.length > 0 ? `WHERE ${conditions.join(' AND ')}` : '';
+  const sql = `SELECT * FROM images ${where} ORDER BY created_at DESC LIMIT 20 OFFSET ?`;
+  params.push(offset);
 
   try {
     const { results } = await env.DB.prepare(sql).bind(...params).all();
@@ -61,9 +67,55 @@ export async function proxyTelegramImage(fileId, botToken, dlExt = null) {
   }
 }
 
+// 非 Telegram 后端存的图，file_name 形如 "s3:<key>" / "local:<path>"
+// s3 优先走 R2 绑定 (IMAGES)，否则和 local 一样回源到配置的公开地址
+export function isStoredRef(ref) {
+  return ref.startsWith('s3:') || ref.startsWith('local:');
+}
+
+export async function proxyStoredImage(ref, env, dlExt = null) {
+  try {
+    const i = ref.indexOf(':');
+    const backend = ref.slice(0, i);
+    const key = ref.slice(i + 1);
+
+    let body, h;
+    if (backend === 's3' && env.IMAGES) {
+      const obj = await env.IMAGES.get(key);
+      if (!obj) return new Response("404", { status: 404 });
+      h = new Headers();
+      obj.writeHttpMetadata(h);
+      body = obj.body;
+    } else {
+      const base = backend === 's3' ? env.S3_PUBLIC_URL : env.LOCAL_PUBLIC_URL;
+      if (!base) return new Response("404", { status: 404 });
+      const r = await fetch(`${base.replace(/\/$/, '')}/${key}`);
+      if (!r.ok) return new Response("404", { status: 404 });
+      h = new Headers(r.headers);
+      body = r.body;
+    }
+
+    h.set("Cache-Control", "public, max-age=31536000, immutable");
+    h.set("Access-Control-Allow-Origin", "*");
+    if (dlExt) {
+      const name = key.split('/').pop();
+      h.set("Content-Disposition", `attachment; filename="${name}"`);
+    }
+    return new Response(body, { headers: h });
+  } catch (e) {
+    return new Response("Error", { status: 500 });
+  }
+}
+
+// 按 Bot 存库时识别的 mime_type 决定下载文件的后缀，旧数据没有时按 jpg
+function extFromMime(mime) {
+  const ext = { 'image/png': 'png', 'image/gif': 'gif', 'image/webp': 'webp', 'image/avif': 'avif', 'image/bmp': 'bmp' };
+  return ext[mime] || 'jpg';
+}
+
 // === 3. 详情页处理函数 ===
 export async function handleDetail(id, env) {
-   const img = await env.DB.prepare("SELECT id, file_name, origin_id, caption, artist, tags, created_at, width, height, artist FROM images WHERE id = ?").bind(id).first();
+   const img = await env.DB.prepare("SELECT * FROM images WHERE id = ?").bind(id).first();
    if (!img) return new Response("404", { status: 404 });
 
    let parentId = img.id;
@@ -89,7 +141,10 @@ export async function handleDetail(id, env) {
    const imagesJson = JSON.stringify(items.map(x => ({
      id: x.id,
      file: x.file_name,
-     download: `/image/${x.origin_id || x.file_name}?dl=jpg`
+     // 超过 50MB 又没存下来的原图 (original_mode = link) 直接去原站下载
+     download: !x.origin_id && x.original_mode === 'link' && x.source_url
+       ? x.source_url
+       : `/image/${x.origin_id || x.file_name}?dl=${extFromMime(x.mime_type)}`
    })));
 
    // 核心变化在这里：直接调用 templates.js 里的函数，而不是自己拼字符串
@@ -299,3 +354,101 @@ export async function handleArtistProfile(artistName, url, env) {
 }
 
 
+
+// === 5. 历史记录增量同步 (Bot 去重用) ===
+// history_log 每一行是一次新增 (add) 或删除 (remove)，version 自增，Bot 只拉取自己版本之后的变化
+const HISTORY_PAGE_SIZE = 5000;
+
+// 建表和打底的 SQL 单独放成常量，Go 端的测试 (internal/database/worker_sql_test.go) 会读出来在 SQLite 上执行
+const HISTORY_TABLE_SQL = "CREATE TABLE IF NOT EXISTS history_log (version INTEGER PRIMARY KEY AUTOINCREMENT, id TEXT NOT NULL, op TEXT NOT NULL)";
+// 第一次使用时日志是空的，用 images 表里已经发过的作品打底，否则 Bot 会把旧作品全部重发一遍
+// 整条语句是原子的，并发请求也只会写入一次
+const HISTORY_SEED_SQL = "INSERT INTO history_log (id, op) SELECT id, 'add' FROM images WHERE NOT EXISTS (SELECT 1 FROM history_log)";
+
+// 每个 Worker 实例只建表、打底一次，之后的请求直接复用
+let historyReady = null;
+
+function ensureHistoryTable(env) {
+  if (!historyReady) {
+    historyReady = setupHistoryTable(env).catch(e => {
+      historyReady = null;
+      throw e;
+    });
+  }
+  return historyReady;
+}
+
+async function setupHistoryTable(env) {
+  await env.DB.prepare(HISTORY_TABLE_SQL).run();
+  try {
+    await env.DB.prepare(HISTORY_SEED_SQL).run();
+  } catch (e) {
+    // 只有 images 表还没建 (Bot 没跑过迁移) 可以跳过，下次请求再试；其它错误照常抛出
+    if (!/no such table/i.test(e.message || '')) throw e;
+    console.log("history_log seed skipped, images table not built yet");
+    historyReady = null;
+  }
+}
+
+// GET /api/history/changes?since=123
+export async function handleHistoryChanges(url, env) {
+  await ensureHistoryTable(env);
+  const since = parseInt(url.searchParams.get('since') || '0', 10) || 0;
+
+  const { results } = await env.DB.prepare(
+    "SELECT version, id, op FROM history_log WHERE version > ? ORDER BY version LIMIT ?"
+  ).bind(since, HISTORY_PAGE_SIZE).all();
+
+  // 同一页里同一个 ID 可能先删后加，按版本顺序只保留最后一次操作
+  const last = new Map();
+  let version = since;
+  for (const row of results) {
+    last.delete(row.id);
+    last.set(row.id, row.op);
+    version = row.version;
+  }
+  const add = [];
+  const remove = [];
+  for (const [id, op] of last) {
+    if (op === 'remove') remove.push(id);
+    else add.push(id);
+  }
+
+  return new Response(JSON.stringify({ version, add, remove, more: results.length === HISTORY_PAGE_SIZE }), {
+    headers: { 'Content-Type': 'application/json' }
+  });
+}
+
+// POST /api/history/append {"add": [...], "remove": [...]}
+export async function handleHistoryAppend(request, env) {
+  await ensureHistoryTable(env);
+  let body;
+  try {
+    body = await request.json();
+  } catch (e) {
+    return new Response("Bad JSON", { status: 400 });
+  }
+
+  const stmt = env.DB.prepare("INSERT INTO history_log (id, op) VALUES (?, ?)");
+  const rows = [
+    ...(body.add || []).map(id => stmt.bind(String(id), 'add')),
+    ...(body.remove || []).map(id => stmt.bind(String(id), 'remove')),
+  ];
+  // D1 单次 batch 不宜过大，分段写入
+  // 只返回这次写入的版本范围，不能用 MAX(version)：其它写入方插在中间的行会被 Bot 跳过
+  let from = 0;
+  let to = 0;
+  for (let i = 0; i < rows.length; i += 100) {
+    const results = await env.DB.batch(rows.slice(i, i + 100));
+    for (const res of results) {
+      const id = res.meta && res.meta.last_row_id;
+      if (!id) continue;
+      if (!from) from = id;
+      to = id;
+    }
+  }
+
+  return new Response(JSON.stringify({ from, to }), {
+    headers: { 'Content-Type': 'application/json' }
+  });
+}